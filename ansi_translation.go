@@ -0,0 +1,120 @@
+package tpcli
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// These are the patterns that tview uses for color tags and for escaped square brackets.
+var (
+	tviewColorTagPattern       = regexp.MustCompile(`\[([a-zA-Z]+|#[0-9a-zA-Z]{6}|\-)?(:([a-zA-Z]+|#[0-9a-zA-Z]{6}|\-)?(:([lbdru]+|\-)?)?)?\]`)
+	tviewEscapedBracketPattern = regexp.MustCompile(`\[([a-zA-Z0-9_,;: \-\."#]+)\[(\[*)\]`)
+)
+
+// resetAllColorsTag restores the default colors and attributes, so that colors in one piece of text do not affect
+// text added after it.
+const resetAllColorsTag = "[-:-:-]"
+
+// TranslatingANSIIn instructs the Tpcli to translate ANSI SGR escape sequences (which set colors and attributes like
+// bold and underline) in text written to an output panel (either GeneralOutputPanel or ErrorOrHistoryPanel) into
+// tview color tags, so that the output of tools like "ls --color" is shown in color.  Other escape sequences (e.g.,
+// those that move the cursor) and control characters (other than newline and tab) are removed, and text that looks
+// like a tview color tag is escaped, so that untrusted text cannot change the layout of the panel.  Colors set by a
+// piece of text do not extend to text written after it.  If panel is CommandPanel, this method panics.  This must be
+// invoked before Start().
+func (ui *Tpcli) TranslatingANSIIn(panel Panel) *Tpcli {
+	ui.settingsForOutputPanel(panel, "TranslatingANSIIn").translateANSI = true
+	return ui
+}
+
+// translateANSIToTviewColorTags returns text with its ANSI SGR escape sequences translated to tview color tags, its
+// other escape sequences and control characters removed, and its remaining text escaped for tview.
+func translateANSIToTviewColorTags(text string) string {
+	var sanitizedText strings.Builder
+
+	runes := []rune(text)
+	startOfPlainText := 0
+
+	for i := 0; i < len(runes); {
+		if runes[i] != '\x1b' && !isARemovedControlCharacter(runes[i]) {
+			i++
+			continue
+		}
+
+		sanitizedText.WriteString(tview.Escape(string(runes[startOfPlainText:i])))
+
+		if runes[i] == '\x1b' {
+			lengthOfSequence, isSGR := lengthOfEscapeSequenceAt(runes, i)
+			if isSGR {
+				// tview.TranslateANSI translates the SGR sequences once the rest of the text has been sanitized
+				sanitizedText.WriteString(string(runes[i : i+lengthOfSequence]))
+			}
+			i += lengthOfSequence
+		} else {
+			i++
+		}
+
+		startOfPlainText = i
+	}
+	sanitizedText.WriteString(tview.Escape(string(runes[startOfPlainText:])))
+
+	return tview.TranslateANSI(sanitizedText.String()) + resetAllColorsTag
+}
+
+func isARemovedControlCharacter(r rune) bool {
+	return (r < 0x20 && r != '\n' && r != '\t') || r == 0x7f || (r >= 0x80 && r < 0xa0)
+}
+
+// lengthOfEscapeSequenceAt returns the number of runes in the escape sequence that starts (with ESC) at runes[start],
+// and whether it is an SGR sequence (ESC [ <parameters> m).  An unterminated sequence extends to the end of runes.
+func lengthOfEscapeSequenceAt(runes []rune, start int) (length int, isSGR bool) {
+	i := start + 1
+	if i >= len(runes) {
+		return i - start, false
+	}
+
+	switch runes[i] {
+	case '[': // Control Sequence Introducer: parameter and intermediate bytes, then a final byte
+		i++
+		for i < len(runes) && runes[i] >= 0x20 && runes[i] <= 0x3f {
+			i++
+		}
+		if i >= len(runes) {
+			return i - start, false
+		}
+		isSGR = runes[i] == 'm'
+		for j := start + 2; j < i; j++ {
+			if runes[j] < 0x30 {
+				isSGR = false // intermediate bytes are not part of an SGR sequence
+			}
+		}
+		return i + 1 - start, isSGR
+
+	case ']', 'P', 'X', '^', '_': // Strings (e.g., OSC), which end with BEL or ST (ESC \)
+		for i++; i < len(runes); i++ {
+			if runes[i] == '\a' {
+				return i + 1 - start, false
+			}
+			if runes[i] == '\x1b' && i+1 < len(runes) && runes[i+1] == '\\' {
+				return i + 2 - start, false
+			}
+		}
+		return i - start, false
+
+	default: // Two-character sequences (e.g., ESC c)
+		return 2, false
+	}
+}
+
+// stripTviewColorTags returns text, which may contain tview color tags and escaped square brackets, as it is shown.
+func stripTviewColorTags(text string) string {
+	withoutColorTags := tviewColorTagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		if tag == "[]" {
+			return tag
+		}
+		return ""
+	})
+	return tviewEscapedBracketPattern.ReplaceAllString(withoutColorTags, `[$1$2]`)
+}
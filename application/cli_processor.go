@@ -1,16 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"net"
-)
+	"os"
+	"strconv"
+	"strings"
 
-const (
-	outputPanel = iota
-	errorPanel
-	historyPanel
-	commandEntryPanel
+	"github.com/blorticus/tpcli"
 )
 
 // CliProcessor processes command-line arguments for the tpcli application
@@ -18,9 +17,32 @@ type CliProcessor struct {
 	usingTCPBindSocket bool
 	tcpBindAddress     *net.TCPAddr
 	unixSocketPath     string
-	panelStack         []int
+	panelLayout        *tpcli.Layout
+	wantsHistoryPanel  bool
 	wantsDebugLogging  bool
 	debugLogFilepath   string
+	historyFilePath    string
+	historySize        uint
+	historyControl     tpcli.HistoryControl
+	wantsViEditing     bool
+	commandPrompt      string
+	exitCommands       []string
+	wantsExitConfirmed bool
+	keyBindings        []KeyBinding
+	maximumPanelLines  uint
+	timestampLayout    string
+	wantsSourceTags    bool
+	wantsANSIColors    bool
+	minimumLevel       tpcli.OutputLevel
+	theme              *tpcli.Theme
+	panelSizes         map[tpcli.Panel]tpcli.PanelSize
+}
+
+// KeyBinding is a key specification (e.g., "Ctrl-L") and the built-in tpcli action (e.g., "clear-general-output")
+// to which it is bound, as read from the -keys file.
+type KeyBinding struct {
+	KeySpec string
+	Action  tpcli.KeyAction
 }
 
 // ProcessCliArguments processes os.Args, searching for requisite flags.  It validates any values passed
@@ -31,15 +53,34 @@ func ProcessCliArguments() (*CliProcessor, error) {
 		usingTCPBindSocket: false,
 		tcpBindAddress:     nil,
 		unixSocketPath:     "",
-		panelStack:         make([]int, 3),
 		wantsDebugLogging:  false,
 		debugLogFilepath:   "",
+		historyFilePath:    "",
+		historySize:        200,
 	}
 
 	tcpBindParameter := flag.String("tcp", "", "ip:tcp-port on which this application should listen for commands")
 	unixBindParameter := flag.String("unix", "", "Path to unix socket on which this application should listen for commands")
-	orderParameter := flag.String("order", "ohc", "Three letters representing panel stack order (o, h, e, and c)")
+	orderParameter := flag.String("order", "ohc", "Three letters representing panel stack order (o, h, e, and c), or a layout expression (e.g., o|h/c)")
 	debugParameter := flag.String("debug", "", "Path to debug log file if debugging is desired")
+	historyParameter := flag.String("history", "", "Path to a file in which the command history is kept between sessions")
+	historySizeParameter := flag.Uint("history-size", 200, "Maximum number of commands kept in the command history")
+	promptParameter := flag.String("prompt", "Enter command>", "Prompt shown in the command entry panel, which may include tview color tags")
+	exitCommandsParameter := flag.String("exit-commands", "quit,exit", "Comma-separated list of commands which exit the application (empty for none)")
+	confirmExitParameter := flag.Bool("confirm-exit", false, "Ask for confirmation before exiting")
+	maxLinesParameter := flag.Uint("max-lines", 10000, "Maximum number of lines kept in each output panel (0 for no limit)")
+	timestampsParameter := flag.String("timestamps", "", "Go time layout (e.g., 15:04:05) of the time shown before each output line, if any")
+	sourceTagsParameter := flag.Bool("source-tags", false, "Show the source ([peer], [local] or [ui]) before each output line")
+	minLevelParameter := flag.String("min-level", "debug", "Least severe level (debug, info, success, warn or error) of leveled output that is shown")
+	heightsParameter := flag.String("heights", "", "Comma-separated panel heights, each <panel letter>=<rows> or <panel letter>=<weight>* (e.g., o=2*,e=10)")
+	growKeyParameter := flag.String("grow-key", "Alt-Up", "Key which makes the panel with focus taller (empty for none)")
+	shrinkKeyParameter := flag.String("shrink-key", "Alt-Down", "Key which makes the panel with focus shorter (empty for none)")
+	maximizeKeyParameter := flag.String("maximize-key", "Alt-z", "Key which maximizes the panel with focus, or restores the panels (empty for none)")
+	themeParameter := flag.String("theme", "", "Built-in theme (dark, light or high-contrast), or path to a theme file")
+	ansiParameter := flag.Bool("ansi", false, "Show ANSI color sequences in output as colors")
+	keysParameter := flag.String("keys", "", "Path to a file of key bindings, each a line of the form: <key> = <action>")
+	viParameter := flag.Bool("vi", false, "Use vi editing, rather than emacs editing, in the command entry panel")
+	historyControlParameter := flag.String("history-control", "", "Colon-separated list of command history policies (ignoredups, erasedups, ignorespace, ignoreboth)")
 
 	flag.Parse()
 
@@ -55,6 +96,43 @@ func ProcessCliArguments() (*CliProcessor, error) {
 		return nil, err
 	}
 
+	if err := processor.processHistoryParameters(*historyParameter, *historySizeParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processHistoryControlParameter(*historyControlParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processKeysParameter(*keysParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processMinLevelParameter(*minLevelParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processHeightsParameter(*heightsParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processPanelSizeKeyParameters(*growKeyParameter, *shrinkKeyParameter, *maximizeKeyParameter); err != nil {
+		return nil, err
+	}
+
+	if err := processor.processThemeParameter(*themeParameter); err != nil {
+		return nil, err
+	}
+
+	processor.maximumPanelLines = *maxLinesParameter
+	processor.timestampLayout = *timestampsParameter
+	processor.wantsSourceTags = *sourceTagsParameter
+	processor.wantsANSIColors = *ansiParameter
+	processor.wantsViEditing = *viParameter
+	processor.commandPrompt = *promptParameter
+	processor.wantsExitConfirmed = *confirmExitParameter
+	processor.processExitCommandsParameter(*exitCommandsParameter)
+
 	return processor, nil
 }
 
@@ -69,10 +147,98 @@ func (processor *CliProcessor) DebugLogFileFullPath() string {
 	return processor.debugLogFilepath
 }
 
-// DesiredPanelStackingOrder returns a list of three elements, indicating the preferred panel stacking
-// order.
-func (processor *CliProcessor) DesiredPanelStackingOrder() []int {
-	return processor.panelStack
+// WantsPersistentCommandHistory is true if the user provided the -history flag.
+func (processor *CliProcessor) WantsPersistentCommandHistory() bool {
+	return processor.historyFilePath != ""
+}
+
+// CommandHistoryFilePath returns the path to the command history file the user provided.  If -history
+// was not supplied, this is the empty string.
+func (processor *CliProcessor) CommandHistoryFilePath() string {
+	return processor.historyFilePath
+}
+
+// CommandHistorySize returns the maximum number of entries in the command history.
+func (processor *CliProcessor) CommandHistorySize() uint {
+	return processor.historySize
+}
+
+// CommandHistoryControl returns the command history policies the user provided with -history-control.
+func (processor *CliProcessor) CommandHistoryControl() tpcli.HistoryControl {
+	return processor.historyControl
+}
+
+// MaximumPanelLines returns the maximum number of lines kept in each output panel, as provided with -max-lines.  If
+// this is 0, there is no limit.
+func (processor *CliProcessor) MaximumPanelLines() uint {
+	return processor.maximumPanelLines
+}
+
+// OutputTimestampLayout returns the time layout provided with -timestamps.  If -timestamps was not supplied, this is
+// the empty string.
+func (processor *CliProcessor) OutputTimestampLayout() string {
+	return processor.timestampLayout
+}
+
+// WantsSourceTags is true if the user provided the -source-tags flag.
+func (processor *CliProcessor) WantsSourceTags() bool {
+	return processor.wantsSourceTags
+}
+
+// WantsANSIColors is true if the user provided the -ansi flag.
+func (processor *CliProcessor) WantsANSIColors() bool {
+	return processor.wantsANSIColors
+}
+
+// MinimumOutputLevel returns the least severe level of leveled output that is shown, as provided with -min-level.
+func (processor *CliProcessor) MinimumOutputLevel() tpcli.OutputLevel {
+	return processor.minimumLevel
+}
+
+// PanelSizes returns the panel heights provided with -heights.  Panels without a height provided are not in the map.
+func (processor *CliProcessor) PanelSizes() map[tpcli.Panel]tpcli.PanelSize {
+	return processor.panelSizes
+}
+
+// Theme returns the theme provided with -theme.  If -theme was not supplied, this is nil.
+func (processor *CliProcessor) Theme() *tpcli.Theme {
+	return processor.theme
+}
+
+// WantsViEditingMode is true if the user provided the -vi flag.
+func (processor *CliProcessor) WantsViEditingMode() bool {
+	return processor.wantsViEditing
+}
+
+// CommandPrompt returns the prompt for the command entry panel.
+func (processor *CliProcessor) CommandPrompt() string {
+	return processor.commandPrompt
+}
+
+// ExitCommands returns the commands which exit the application.  This may be empty.
+func (processor *CliProcessor) ExitCommands() []string {
+	return processor.exitCommands
+}
+
+// WantsExitConfirmation is true if the user provided the -confirm-exit flag.
+func (processor *CliProcessor) WantsExitConfirmation() bool {
+	return processor.wantsExitConfirmed
+}
+
+// KeyBindings returns the key bindings read from the -keys file, in the order they appear in the file.  If -keys
+// was not supplied, this is empty.
+func (processor *CliProcessor) KeyBindings() []KeyBinding {
+	return processor.keyBindings
+}
+
+// DesiredPanelLayout returns the panel layout provided by -order.
+func (processor *CliProcessor) DesiredPanelLayout() *tpcli.Layout {
+	return processor.panelLayout
+}
+
+// WantsCommandHistoryPanel is true if -order uses 'h' (rather than 'e') for the third panel.
+func (processor *CliProcessor) WantsCommandHistoryPanel() bool {
+	return processor.wantsHistoryPanel
 }
 
 // WantsToBindToTCPSocket returns true if the user wants to bind to a tcp socket.
@@ -124,38 +290,43 @@ func (processor *CliProcessor) processBindParameter(tcpBindParameterValue string
 	return nil
 }
 
+// processOrderParameter processes -order, which is either three letters giving the order in which the panels are
+// stacked (e.g., "ohc"), or a layout expression, as accepted by tpcli.ParseLayout (e.g., "o|h/c").  In either case,
+// 'h' is the command history panel and 'e' is the error panel.
 func (processor *CliProcessor) processOrderParameter(orderParameterValue string) error {
-	if len(orderParameterValue) != 3 {
-		return fmt.Errorf("-order must be exactly three letters")
-	}
-
-	orderLettersGiven := make(map[rune]bool)
-	for indexOfLetterInString, orderLetter := range string(orderParameterValue) {
-		if _, letterAlreadyProvided := orderLettersGiven[orderLetter]; letterAlreadyProvided {
-			return fmt.Errorf("In -order, a single letter cannot be provided more than once")
+	layoutExpression := orderParameterValue
+	if !strings.ContainsAny(orderParameterValue, "/|()*") {
+		if len(orderParameterValue) != 3 {
+			return fmt.Errorf("-order must be exactly three letters, or a layout expression")
 		}
 
-		switch orderLetter {
-		case 'o':
-			processor.panelStack[indexOfLetterInString] = outputPanel
-		case 'h':
-			processor.panelStack[indexOfLetterInString] = historyPanel
-		case 'e':
-			processor.panelStack[indexOfLetterInString] = errorPanel
-		case 'c':
-			processor.panelStack[indexOfLetterInString] = commandEntryPanel
-		default:
-			return fmt.Errorf("In -order, only 'o', 'h', 'e', and 'c' are allowed")
+		orderLettersGiven := make(map[rune]bool)
+		for _, orderLetter := range orderParameterValue {
+			if !strings.ContainsRune("ohec", orderLetter) {
+				return fmt.Errorf("In -order, only 'o', 'h', 'e', and 'c' are allowed")
+			}
+			if orderLettersGiven[orderLetter] {
+				return fmt.Errorf("In -order, a single letter cannot be provided more than once")
+			}
+			orderLettersGiven[orderLetter] = true
 		}
-		orderLettersGiven[orderLetter] = true
+
+		layoutExpression = strings.Join(strings.Split(orderParameterValue, ""), "/")
 	}
 
-	if _, providedLetterH := orderLettersGiven['h']; providedLetterH {
-		if _, providedLetterE := orderLettersGiven['e']; providedLetterE {
-			return fmt.Errorf("-order must have exactly one of 'h' or 'e', but cannot have both")
-		}
+	providedLetterH, providedLetterE := strings.ContainsRune(layoutExpression, 'h'), strings.ContainsRune(layoutExpression, 'e')
+	if providedLetterH && providedLetterE {
+		return fmt.Errorf("-order must have exactly one of 'h' or 'e', but cannot have both")
+	}
+
+	layout, err := tpcli.ParseLayout(layoutExpression)
+	if err != nil {
+		return fmt.Errorf("In -order, %s", err.Error())
 	}
 
+	processor.panelLayout = layout
+	processor.wantsHistoryPanel = providedLetterH
+
 	return nil
 }
 
@@ -166,3 +337,187 @@ func (processor *CliProcessor) processDebugParameter(debugParameterValue string)
 	}
 	return nil
 }
+
+func (processor *CliProcessor) processHistoryParameters(historyParameterValue string, historySizeParameterValue uint) error {
+	if historySizeParameterValue == 0 {
+		return fmt.Errorf("-history-size must be greater than zero")
+	}
+
+	processor.historyFilePath = historyParameterValue
+	processor.historySize = historySizeParameterValue
+	return nil
+}
+
+func (processor *CliProcessor) processHistoryControlParameter(historyControlParameterValue string) error {
+	if historyControlParameterValue == "" {
+		return nil
+	}
+
+	for _, policyName := range strings.Split(historyControlParameterValue, ":") {
+		switch policyName {
+		case "ignoredups":
+			processor.historyControl |= tpcli.IgnoreConsecutiveDuplicates
+		case "erasedups":
+			processor.historyControl |= tpcli.EraseOlderDuplicates
+		case "ignorespace":
+			processor.historyControl |= tpcli.IgnoreItemsStartingWithSpace
+		case "ignoreboth":
+			processor.historyControl |= tpcli.IgnoreConsecutiveDuplicates | tpcli.IgnoreItemsStartingWithSpace
+		default:
+			return fmt.Errorf("In -history-control, (%s) is not a known policy", policyName)
+		}
+	}
+
+	return nil
+}
+
+func (processor *CliProcessor) processMinLevelParameter(minLevelParameterValue string) error {
+	level, err := tpcli.OutputLevelNamed(minLevelParameterValue)
+	if err != nil {
+		return fmt.Errorf("In -min-level, %s", err.Error())
+	}
+
+	processor.minimumLevel = level
+	return nil
+}
+
+// processHeightsParameter reads the panel heights, which are a comma-separated list of <panel letter>=<rows> or
+// <panel letter>=<weight>*, where the panel letters are those used by -order.  The command panel must have a fixed
+// height.
+func (processor *CliProcessor) processHeightsParameter(heightsParameterValue string) error {
+	processor.panelSizes = make(map[tpcli.Panel]tpcli.PanelSize)
+	if heightsParameterValue == "" {
+		return nil
+	}
+
+	for _, panelHeight := range strings.Split(heightsParameterValue, ",") {
+		panelLetterAndHeight := strings.SplitN(strings.TrimSpace(panelHeight), "=", 2)
+		if len(panelLetterAndHeight) != 2 {
+			return fmt.Errorf("In -heights, (%s) is not of the form <panel letter>=<height>", panelHeight)
+		}
+
+		var panel tpcli.Panel
+		switch panelLetterAndHeight[0] {
+		case "o":
+			panel = tpcli.GeneralOutputPanel
+		case "e", "h":
+			panel = tpcli.ErrorOrHistoryPanel
+		case "c":
+			panel = tpcli.CommandPanel
+		default:
+			return fmt.Errorf("In -heights, only 'o', 'h', 'e', and 'c' are allowed")
+		}
+
+		height := panelLetterAndHeight[1]
+		heightIsAWeight := strings.HasSuffix(height, "*")
+
+		heightAsNumber, err := strconv.ParseUint(strings.TrimSuffix(height, "*"), 10, 16)
+		if err != nil || heightAsNumber == 0 {
+			return fmt.Errorf("In -heights, (%s) is not a positive number of rows or weight", height)
+		}
+
+		if heightIsAWeight {
+			if panel == tpcli.CommandPanel {
+				return fmt.Errorf("In -heights, the command panel must have a number of rows")
+			}
+			processor.panelSizes[panel] = tpcli.ProportionOfRemainingRows(uint(heightAsNumber))
+		} else {
+			processor.panelSizes[panel] = tpcli.FixedRows(uint(heightAsNumber))
+		}
+	}
+
+	return nil
+}
+
+// processPanelSizeKeyParameters adds key bindings for the keys that grow, shrink and maximize the panel with focus.
+// They follow any bindings from the -keys file, which therefore take precedence.
+func (processor *CliProcessor) processPanelSizeKeyParameters(growKeyParameterValue string, shrinkKeyParameterValue string, maximizeKeyParameterValue string) error {
+	for _, keyAndAction := range []struct {
+		flagName string
+		keySpec  string
+		action   tpcli.KeyAction
+	}{
+		{"-grow-key", growKeyParameterValue, tpcli.GrowFocusedPanel},
+		{"-shrink-key", shrinkKeyParameterValue, tpcli.ShrinkFocusedPanel},
+		{"-maximize-key", maximizeKeyParameterValue, tpcli.ToggleMaximizedPanel},
+	} {
+		if keyAndAction.keySpec == "" {
+			continue
+		}
+
+		if err := tpcli.ValidateKeyBinding(keyAndAction.keySpec, string(keyAndAction.action)); err != nil {
+			return fmt.Errorf("In %s, %s", keyAndAction.flagName, err.Error())
+		}
+
+		processor.keyBindings = append(processor.keyBindings, KeyBinding{KeySpec: keyAndAction.keySpec, Action: keyAndAction.action})
+	}
+
+	return nil
+}
+
+// processThemeParameter uses the built-in theme named by the -theme value or, if there is no such theme, reads the
+// value as the path to a theme file (see readThemeFile).
+func (processor *CliProcessor) processThemeParameter(themeParameterValue string) error {
+	if themeParameterValue == "" {
+		return nil
+	}
+
+	if theme, err := tpcli.ThemeNamed(themeParameterValue); err == nil {
+		processor.theme = theme
+		return nil
+	}
+
+	theme, err := readThemeFile(themeParameterValue)
+	if err != nil {
+		return err
+	}
+
+	processor.theme = theme
+	return nil
+}
+
+func (processor *CliProcessor) processExitCommandsParameter(exitCommandsParameterValue string) {
+	processor.exitCommands = []string{}
+	for _, exitCommand := range strings.Split(exitCommandsParameterValue, ",") {
+		if exitCommand = strings.TrimSpace(exitCommand); exitCommand != "" {
+			processor.exitCommands = append(processor.exitCommands, exitCommand)
+		}
+	}
+}
+
+// processKeysParameter reads the key bindings file.  Each line is of the form "<key> = <action>", where <key> is a
+// tpcli key specification (e.g., "Ctrl-X Ctrl-S") and <action> is the name of a built-in tpcli action (e.g.,
+// "scroll-to-bottom").  Blank lines and lines starting with '#' are ignored.
+func (processor *CliProcessor) processKeysParameter(keysParameterValue string) error {
+	if keysParameterValue == "" {
+		return nil
+	}
+
+	keysFile, err := os.Open(keysParameterValue)
+	if err != nil {
+		return fmt.Errorf("Unable to read -keys file: %s", err.Error())
+	}
+	defer keysFile.Close()
+
+	scanner := bufio.NewScanner(keysFile)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keySpecAndAction := strings.SplitN(line, "=", 2)
+		if len(keySpecAndAction) != 2 {
+			return fmt.Errorf("In -keys file, line %d is not of the form <key> = <action>", lineNumber)
+		}
+
+		keySpec, action := strings.TrimSpace(keySpecAndAction[0]), strings.TrimSpace(keySpecAndAction[1])
+		if err := tpcli.ValidateKeyBinding(keySpec, action); err != nil {
+			return fmt.Errorf("In -keys file, line %d: %s", lineNumber, err.Error())
+		}
+
+		processor.keyBindings = append(processor.keyBindings, KeyBinding{KeySpec: keySpec, Action: tpcli.KeyAction(action)})
+	}
+
+	return scanner.Err()
+}
@@ -6,12 +6,15 @@ import (
 	"io"
 	"net"
 	"os"
+
+	"github.com/blorticus/tpcli"
 )
 
 // PeerMessageJSON is the json package type mapping for a peer message
 type PeerMessageJSON struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
+	Level   string `json:"level,omitempty"`
 }
 
 // PeerMessageType represents types of peer message
@@ -27,10 +30,12 @@ const (
 	UserExited
 )
 
-// PeerMessage represents a message delivered to or received from a remote peer
+// PeerMessage represents a message delivered to or received from a remote peer.  Level is the optional severity
+// (e.g., "warn") of a GeneralOutput or ErrorOuput message, and is the empty string if the message has none.
 type PeerMessage struct {
 	Type    PeerMessageType
 	Message string
+	Level   string
 }
 
 // TypeAsString returns the message type as a string appropriate for the JSON type field
@@ -220,6 +225,7 @@ func (broker *PeerCommunicationBroker) StartListening() {
 		} else {
 			if nextPeerMessage, err = broker.convertPeerMessageJSONToMessageObject(&nextJSONMessage); err != nil {
 				broker.peerCommunicationErrorHandler(broker, peerConnection, fmt.Errorf("Error decoding incoming JSON: %s", err.Error()))
+				continue
 			}
 
 			broker.channelOfMessagesFromPeers <- nextPeerMessage
@@ -241,10 +247,20 @@ func (broker *PeerCommunicationBroker) convertPeerMessageJSONToMessageObject(jso
 	case "input_command_replacement":
 		return &PeerMessage{Type: InputCommandReplacement, Message: jsonMessage.Message}, nil
 	case "general_output":
-		return &PeerMessage{Type: GeneralOutput, Message: jsonMessage.Message}, nil
+		return broker.convertLeveledOutputJSONToMessageObject(GeneralOutput, jsonMessage)
 	case "error_output":
-		return &PeerMessage{Type: ErrorOuput, Message: jsonMessage.Message}, nil
+		return broker.convertLeveledOutputJSONToMessageObject(ErrorOuput, jsonMessage)
 	default:
 		return nil, fmt.Errorf("Invalid type (%s) in peer message", jsonMessage.Type)
 	}
 }
+
+func (broker *PeerCommunicationBroker) convertLeveledOutputJSONToMessageObject(messageType PeerMessageType, jsonMessage *PeerMessageJSON) (*PeerMessage, error) {
+	if jsonMessage.Level != "" {
+		if _, err := tpcli.OutputLevelNamed(jsonMessage.Level); err != nil {
+			return nil, fmt.Errorf("Invalid level (%s) in peer message", jsonMessage.Level)
+		}
+	}
+
+	return &PeerMessage{Type: messageType, Message: jsonMessage.Message, Level: jsonMessage.Level}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blorticus/tpcli"
+	"github.com/gdamore/tcell/v2"
+)
+
+// readThemeFile reads a theme file.  Each line is of the form "<setting> = <value>".  The optional "base" setting
+// names the built-in theme (dark, light or high-contrast) on which the theme is based, and must come first; the
+// default is dark.  Color settings (e.g., "border") take a tcell color name (e.g., "navy") or "#rrggbb".  Style
+// settings ("find-match" and the output levels, e.g., "warn") take "<foreground>[:<background>[:<attributes>]]", where
+// each color may be empty for the default, and <attributes> is any of b (bold), d (dim), l (blink), r (reverse) and
+// u (underline).  Blank lines and lines starting with '#' are ignored.
+func readThemeFile(themeFilePath string) (*tpcli.Theme, error) {
+	themeFile, err := os.Open(themeFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read -theme file: %s", err.Error())
+	}
+	defer themeFile.Close()
+
+	theme := tpcli.DarkTheme()
+	aSettingHasBeenApplied := false
+
+	scanner := bufio.NewScanner(themeFile)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		settingAndValue := strings.SplitN(line, "=", 2)
+		if len(settingAndValue) != 2 {
+			return nil, fmt.Errorf("In -theme file, line %d is not of the form <setting> = <value>", lineNumber)
+		}
+
+		setting, value := strings.TrimSpace(settingAndValue[0]), strings.TrimSpace(settingAndValue[1])
+
+		if setting == "base" {
+			if aSettingHasBeenApplied {
+				return nil, fmt.Errorf("In -theme file, line %d: base must come before any other setting", lineNumber)
+			}
+			if theme, err = tpcli.ThemeNamed(value); err != nil {
+				return nil, fmt.Errorf("In -theme file, line %d: %s", lineNumber, err.Error())
+			}
+			continue
+		}
+
+		if err := applyThemeSetting(theme, setting, value); err != nil {
+			return nil, fmt.Errorf("In -theme file, line %d: %s", lineNumber, err.Error())
+		}
+		aSettingHasBeenApplied = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return theme, nil
+}
+
+func applyThemeSetting(theme *tpcli.Theme, setting string, value string) error {
+	colorSettings := map[string]*tcell.Color{
+		"background":         &theme.PanelBackground,
+		"text":               &theme.Text,
+		"border":             &theme.Border,
+		"title":              &theme.Title,
+		"focused-border":     &theme.FocusedBorder,
+		"focused-title":      &theme.FocusedTitle,
+		"prompt":             &theme.Prompt,
+		"command-text":       &theme.CommandText,
+		"command-background": &theme.CommandBackground,
+		"hint":               &theme.Hint,
+		"dialog-background":  &theme.DialogBackground,
+		"dialog-text":        &theme.DialogText,
+		"button-background":  &theme.ButtonBackground,
+		"button-text":        &theme.ButtonText,
+	}
+
+	if colorSetting, isAColorSetting := colorSettings[setting]; isAColorSetting {
+		color, err := colorNamed(value)
+		if err != nil {
+			return err
+		}
+		*colorSetting = color
+		return nil
+	}
+
+	var level tpcli.OutputLevel
+	if setting != "find-match" {
+		var err error
+		if level, err = tpcli.OutputLevelNamed(setting); err != nil {
+			return fmt.Errorf("(%s) is not a theme setting", setting)
+		}
+	}
+
+	style, err := styleFromThemeValue(value)
+	if err != nil {
+		return err
+	}
+
+	if setting == "find-match" {
+		theme.FindMatch = style
+	} else {
+		theme.LevelStyles[level] = style
+	}
+
+	return nil
+}
+
+// styleFromThemeValue converts a style value (e.g., "red::b") to a tcell.Style.
+func styleFromThemeValue(value string) (tcell.Style, error) {
+	style := tcell.StyleDefault
+	fields := strings.Split(value, ":")
+	if len(fields) > 3 {
+		return style, fmt.Errorf("(%s) is not of the form <foreground>[:<background>[:<attributes>]]", value)
+	}
+
+	foreground, err := colorNamed(fields[0])
+	if err != nil {
+		return style, err
+	}
+	style = style.Foreground(foreground)
+
+	if len(fields) > 1 {
+		background, err := colorNamed(fields[1])
+		if err != nil {
+			return style, err
+		}
+		style = style.Background(background)
+	}
+
+	if len(fields) > 2 {
+		for _, attribute := range fields[2] {
+			switch attribute {
+			case 'b':
+				style = style.Bold(true)
+			case 'd':
+				style = style.Dim(true)
+			case 'l':
+				style = style.Blink(true)
+			case 'r':
+				style = style.Reverse(true)
+			case 'u':
+				style = style.Underline(true)
+			default:
+				return style, fmt.Errorf("(%c) is not a style attribute", attribute)
+			}
+		}
+	}
+
+	return style, nil
+}
+
+// colorNamed returns the tcell color with the provided name, or #rrggbb value.  An empty name or "-" is the default
+// color.
+func colorNamed(name string) (tcell.Color, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "-" {
+		return tcell.ColorDefault, nil
+	}
+
+	if color, isANamedColor := tcell.ColorNames[name]; isANamedColor {
+		return color, nil
+	}
+
+	if strings.HasPrefix(name, "#") && len(name) == 7 {
+		if color := tcell.GetColor(name); color != tcell.ColorDefault {
+			return color, nil
+		}
+	}
+
+	return tcell.ColorDefault, fmt.Errorf("(%s) is not a color name or #rrggbb value", name)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +11,12 @@ import (
 	"github.com/blorticus/tpcli"
 )
 
+// The sources to which output is attributed, which are shown if -source-tags is provided
+const (
+	peerSource  = "peer"
+	localSource = "local"
+)
+
 func main() {
 	mainApplication := &application{}
 
@@ -31,41 +38,69 @@ func main() {
 
 	channelOfMessagesFromPeer := broker.ChannelOfMessagesFromPeers()
 
-	tpcliStackingOrder, usingCommandHistoryPanel := mainApplication.DeriveTpcliPanelStackingOrderFromCliProcessorStackOrder(cliArgumentsProcessor.DesiredPanelStackingOrder())
-
 	ui := tpcli.NewUI()
-	ui.ChangeStackingOrderTo(tpcliStackingOrder)
+	ui.UsingLayout(cliArgumentsProcessor.DesiredPanelLayout())
+	ui.ChangePromptTo(cliArgumentsProcessor.CommandPrompt())
+	if cliArgumentsProcessor.Theme() != nil {
+		ui.UsingTheme(cliArgumentsProcessor.Theme())
+	}
+	ui.LimitingPanelLinesTo(tpcli.GeneralOutputPanel, cliArgumentsProcessor.MaximumPanelLines()).
+		LimitingPanelLinesTo(tpcli.ErrorOrHistoryPanel, cliArgumentsProcessor.MaximumPanelLines()).
+		TimestampingPanelLinesUsing(tpcli.GeneralOutputPanel, cliArgumentsProcessor.OutputTimestampLayout()).
+		TimestampingPanelLinesUsing(tpcli.ErrorOrHistoryPanel, cliArgumentsProcessor.OutputTimestampLayout())
+	if cliArgumentsProcessor.WantsSourceTags() {
+		ui.ShowingSourceTagsIn(tpcli.GeneralOutputPanel).ShowingSourceTagsIn(tpcli.ErrorOrHistoryPanel)
+	}
+	ui.ShowingOutputAtOrAboveLevel(tpcli.GeneralOutputPanel, cliArgumentsProcessor.MinimumOutputLevel()).
+		ShowingOutputAtOrAboveLevel(tpcli.ErrorOrHistoryPanel, cliArgumentsProcessor.MinimumOutputLevel())
+	if cliArgumentsProcessor.WantsANSIColors() {
+		ui.TranslatingANSIIn(tpcli.GeneralOutputPanel).TranslatingANSIIn(tpcli.ErrorOrHistoryPanel)
+	}
+	ui.ExitingOnCommands(cliArgumentsProcessor.ExitCommands()...)
+	if cliArgumentsProcessor.WantsExitConfirmation() {
+		ui.ConfirmingExit()
+	}
 
-	if usingCommandHistoryPanel {
+	if cliArgumentsProcessor.WantsCommandHistoryPanel() {
 		ui.UsingCommandHistoryPanel()
 	}
 
-	channelOfUserEnteredCommands := ui.ChannelOfEnteredCommands()
+	ui.LimitingCommandHistoryTo(cliArgumentsProcessor.CommandHistorySize()).
+		ControllingCommandHistoryWith(cliArgumentsProcessor.CommandHistoryControl())
+	if cliArgumentsProcessor.WantsPersistentCommandHistory() {
+		ui.UsingCommandHistoryFile(cliArgumentsProcessor.CommandHistoryFilePath())
+	}
+
+	for panel, size := range cliArgumentsProcessor.PanelSizes() {
+		ui.SizingPanel(panel, size)
+	}
+
+	for _, binding := range cliArgumentsProcessor.KeyBindings() {
+		ui.BindingKeyToAction(binding.KeySpec, binding.Action)
+	}
+
+	if cliArgumentsProcessor.WantsViEditingMode() {
+		ui.UsingViEditingMode()
+	}
+
+	channelOfUIEvents := ui.ChannelOfEvents()
 
 	broker.
 		OnIncomingPeerAccept(func(broker *PeerCommunicationBroker, peerConnection net.Conn) {
-			ui.FmtToGeneralOutput("Incoming connection from (%s)", peerConnection.RemoteAddr().String())
+			ui.AddStringFromSourceToGeneralOutput(localSource, fmt.Sprintf("Incoming connection from (%s)", peerConnection.RemoteAddr().String()))
 		}).
 		OnPeerClosure(func(broker *PeerCommunicationBroker, peerConnection net.Conn) {
-			ui.FmtToGeneralOutput("Connection closed for peer (%s)", peerConnection.RemoteAddr().String())
+			ui.AddStringFromSourceToGeneralOutput(localSource, fmt.Sprintf("Connection closed for peer (%s)", peerConnection.RemoteAddr().String()))
 		}).
 		OnGeneralCommunicationError(func(broker *PeerCommunicationBroker, err error) {
-			ui.FmtToErrorOutput("General error: %s", err.Error())
+			ui.AddStringFromSourceToErrorOutput(localSource, fmt.Sprintf("General error: %s", err.Error()))
 		}).
 		OnPeerCommunicationError(func(broker *PeerCommunicationBroker, peerConnection net.Conn, err error) {
-			ui.FmtToErrorOutput("Peer communication error with peer (%s): %s", peerConnection.RemoteAddr().String(), err.Error())
+			ui.AddStringFromSourceToErrorOutput(localSource, fmt.Sprintf("Peer communication error with peer (%s): %s", peerConnection.RemoteAddr().String(), err.Error()))
 		})
 
-	ui.OnUIExit(func() {
-		broker.SendMessageToPeer(&PeerMessage{
-			Type:    UserExited,
-			Message: "",
-		})
-		broker.Terminate()
-		os.Exit(0)
-	})
-
-	go ui.Start()
+	errorFromUI := make(chan error, 1)
+	go func() { errorFromUI <- ui.Run(context.Background()) }()
 	go broker.StartListening()
 
 	for {
@@ -73,21 +108,45 @@ func main() {
 		case messageFromPeer := <-channelOfMessagesFromPeer:
 			switch messageFromPeer.Type {
 			case ProtocolError:
-				ui.FmtToErrorOutput("Peer reports protocol error: %s", messageFromPeer.Message)
+				ui.AddStringFromSourceToErrorOutput(peerSource, fmt.Sprintf("Peer reports protocol error: %s", messageFromPeer.Message))
 			case InputCommandReplacement:
 				ui.ReplaceCommandStringWith(messageFromPeer.Message)
 			case GeneralOutput:
-				ui.AddStringToGeneralOutput(messageFromPeer.Message)
+				if level, err := tpcli.OutputLevelNamed(messageFromPeer.Level); err == nil {
+					ui.AddLeveledStringFromSourceToGeneralOutput(level, peerSource, messageFromPeer.Message)
+				} else {
+					ui.AddStringFromSourceToGeneralOutput(peerSource, messageFromPeer.Message)
+				}
 			case ErrorOuput:
-				ui.AddStringToErrorOutput(messageFromPeer.Message)
+				if level, err := tpcli.OutputLevelNamed(messageFromPeer.Level); err == nil {
+					ui.AddLeveledStringFromSourceToErrorOutput(level, peerSource, messageFromPeer.Message)
+				} else {
+					ui.AddStringFromSourceToErrorOutput(peerSource, messageFromPeer.Message)
+				}
 			default:
 				broker.SendMessageToPeer(&PeerMessage{
 					Type:    ProtocolError,
 					Message: fmt.Sprintf("invalid type (%s)", messageFromPeer.TypeAsString()),
 				})
 			}
-		case userEnteredCommand := <-channelOfUserEnteredCommands:
-			broker.SendMessageToPeer(&PeerMessage{Type: InputCommandReceived, Message: userEnteredCommand})
+		case err := <-errorFromUI:
+			mainApplication.dieIfError(err)
+		case uiEvent, uiIsRunning := <-channelOfUIEvents:
+			if !uiIsRunning {
+				broker.Terminate()
+				return
+			}
+			switch uiEvent.Type {
+			case tpcli.CommandEntered:
+				broker.SendMessageToPeer(&PeerMessage{Type: InputCommandReceived, Message: uiEvent.Command})
+			case tpcli.ExitRequested:
+				broker.SendMessageToPeer(&PeerMessage{
+					Type:    UserExited,
+					Message: "",
+				})
+				broker.Terminate()
+				return
+			}
 		}
 	}
 }
@@ -113,51 +172,6 @@ func (app *application) dieIfError(err error) {
 	}
 }
 
-func (app *application) DeriveTpcliPanelStackingOrderFromCliProcessorStackOrder(appStackOrder []int) (tpcliStackingOrder tpcli.StackingOrder, usingCommandHistoryPanel bool) {
-	switch appStackOrder[0] {
-	case outputPanel:
-		switch appStackOrder[1] {
-		case errorPanel:
-			return tpcli.GeneralErrorCommand, false
-		case historyPanel:
-			return tpcli.GeneralErrorCommand, true
-		case commandEntryPanel:
-			if appStackOrder[2] == errorPanel {
-				return tpcli.GeneralCommandError, false
-			}
-			return tpcli.GeneralCommandError, true
-		}
-	case errorPanel:
-		switch appStackOrder[1] {
-		case outputPanel:
-			return tpcli.ErrorGeneralCommand, false
-		case commandEntryPanel:
-			return tpcli.ErrorCommandGeneral, false
-		}
-	case historyPanel:
-		switch appStackOrder[1] {
-		case outputPanel:
-			return tpcli.ErrorGeneralCommand, true
-		case commandEntryPanel:
-			return tpcli.ErrorCommandGeneral, true
-		}
-	case commandEntryPanel:
-		switch appStackOrder[1] {
-		case outputPanel:
-			if appStackOrder[2] == errorPanel {
-				return tpcli.CommandGeneralError, false
-			}
-			return tpcli.CommandGeneralError, true
-		case errorPanel:
-			return tpcli.CommandErrorGeneral, false
-		case historyPanel:
-			return tpcli.CommandErrorGeneral, true
-		}
-	}
-
-	return tpcli.GeneralErrorCommand, true
-}
-
 func (app *application) activateDebugLoggingUsingFile(fileName string) {
 	fileHandle, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0640)
 	panicIfError(err)
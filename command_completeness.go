@@ -0,0 +1,38 @@
+package tpcli
+
+import "strings"
+
+// CommandHasBalancedBrackets returns true unless commandText has an opening bracket ('{', '[' or '(') that has not been
+// closed, or a double-quoted string that has not been terminated.  Brackets inside double-quoted strings are ignored,
+// and a backslash inside a double-quoted string escapes the character that follows it.  This is suitable for entering
+// JSON bodies, and may be passed to Tpcli.UsingMultiLineCommandInput().
+func CommandHasBalancedBrackets(commandText string) bool {
+	depth := 0
+	insideQuotedString := false
+	escaping := false
+
+	for _, r := range commandText {
+		switch {
+		case escaping:
+			escaping = false
+		case insideQuotedString && r == '\\':
+			escaping = true
+		case r == '"':
+			insideQuotedString = !insideQuotedString
+		case insideQuotedString:
+		case r == '{' || r == '[' || r == '(':
+			depth++
+		case r == '}' || r == ']' || r == ')':
+			depth--
+		}
+	}
+
+	return depth <= 0 && !insideQuotedString
+}
+
+// CommandHasNoTrailingBackslash returns false if commandText ends with a backslash (ignoring trailing whitespace),
+// which is the shell convention for continuing a command on the next line.  It may be passed to
+// Tpcli.UsingMultiLineCommandInput().
+func CommandHasNoTrailingBackslash(commandText string) bool {
+	return !strings.HasSuffix(strings.TrimRight(commandText, " \t"), `\`)
+}
@@ -0,0 +1,27 @@
+package tpcli_test
+
+import (
+	"github.com/blorticus/tpcli"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("command completeness predicates", func() {
+	It("should find bracket balance outside of quoted strings", func() {
+		Expect(tpcli.CommandHasBalancedBrackets("show")).To(BeTrue())
+		Expect(tpcli.CommandHasBalancedBrackets(`post {"a": [1, 2]}`)).To(BeTrue())
+		Expect(tpcli.CommandHasBalancedBrackets(`post {"a": [1, 2]`)).To(BeFalse())
+		Expect(tpcli.CommandHasBalancedBrackets(`post {"a": "}"`)).To(BeFalse())
+		Expect(tpcli.CommandHasBalancedBrackets(`post {"a": "\"}"}`)).To(BeTrue())
+		Expect(tpcli.CommandHasBalancedBrackets(`post "unterminated`)).To(BeFalse())
+		Expect(tpcli.CommandHasBalancedBrackets(`post )`)).To(BeTrue())
+	})
+
+	It("should treat a trailing backslash as a continuation", func() {
+		Expect(tpcli.CommandHasNoTrailingBackslash(`run a`)).To(BeTrue())
+		Expect(tpcli.CommandHasNoTrailingBackslash(`run a \`)).To(BeFalse())
+		Expect(tpcli.CommandHasNoTrailingBackslash("run a \\  ")).To(BeFalse())
+		Expect(tpcli.CommandHasNoTrailingBackslash(`run \ a`)).To(BeTrue())
+	})
+})
@@ -0,0 +1,331 @@
+package tpcli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type grammarTokenType int
+
+const (
+	literalToken grammarTokenType = iota
+	wordPlaceholder
+	intPlaceholder
+	floatPlaceholder
+	restPlaceholder
+	choicePlaceholder
+)
+
+var patternForGrammarTokenType = map[grammarTokenType]string{
+	wordPlaceholder:  `\S+`,
+	intPlaceholder:   `-?\d+`,
+	floatPlaceholder: `-?\d+(?:\.\d+)?`,
+	restPlaceholder:  `.+`,
+}
+
+type grammarToken struct {
+	tokenType grammarTokenType
+	text      string // the literal keyword, or the placeholder as it appears in the grammar
+	choices   []string
+	matcher   *regexp.Regexp
+}
+
+func (token *grammarToken) acceptsWord(word string) bool {
+	if token.tokenType == literalToken {
+		return word == token.text
+	}
+	return token.matcher.MatchString(word)
+}
+
+func (token *grammarToken) acceptsPartialWord(partialWord string) bool {
+	switch token.tokenType {
+	case literalToken:
+		return strings.HasPrefix(token.text, partialWord)
+	case choicePlaceholder:
+		return len(token.completionCandidatesFor(partialWord)) > 0
+	default:
+		return true
+	}
+}
+
+func (token *grammarToken) completionCandidatesFor(partialWord string) []string {
+	candidates := []string{}
+
+	switch token.tokenType {
+	case literalToken:
+		if strings.HasPrefix(token.text, partialWord) {
+			candidates = append(candidates, token.text)
+		}
+	case choicePlaceholder:
+		for _, choice := range token.choices {
+			if strings.HasPrefix(choice, partialWord) {
+				candidates = append(candidates, choice)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// commandGrammar is the parsed form of a grammar supplied to WhenCommandFollowsGrammar.
+type commandGrammar struct {
+	asProvided string
+	tokens     []*grammarToken
+}
+
+// parseCommandGrammar converts a grammar string into a commandGrammar.  A grammar is a sequence of whitespace
+// separated tokens.  A token that is not enclosed in angle brackets is a literal keyword.  A token enclosed in
+// angle brackets is a typed placeholder of the form <name> or <name:type>.  The type may be "word" (the default,
+// any run of non-whitespace), "int", "float", "rest" (everything to the end of the command, which may only be the
+// last token) or a list of choices separated by '|' (e.g., <state:on|off>).
+func parseCommandGrammar(grammar string) (*commandGrammar, error) {
+	fields := strings.Fields(grammar)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("grammar is empty")
+	}
+
+	parsed := &commandGrammar{
+		asProvided: strings.Join(fields, " "),
+		tokens:     make([]*grammarToken, 0, len(fields)),
+	}
+
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "<") {
+			parsed.tokens = append(parsed.tokens, &grammarToken{tokenType: literalToken, text: field})
+			continue
+		}
+
+		if !strings.HasSuffix(field, ">") || len(field) < 3 {
+			return nil, fmt.Errorf("placeholder (%s) is not of the form <name> or <name:type>", field)
+		}
+
+		token := &grammarToken{tokenType: wordPlaceholder, text: field}
+
+		nameAndType := strings.SplitN(field[1:len(field)-1], ":", 2)
+		if nameAndType[0] == "" {
+			return nil, fmt.Errorf("placeholder (%s) has no name", field)
+		}
+
+		if len(nameAndType) == 2 {
+			switch nameAndType[1] {
+			case "word":
+				token.tokenType = wordPlaceholder
+			case "int":
+				token.tokenType = intPlaceholder
+			case "float":
+				token.tokenType = floatPlaceholder
+			case "rest":
+				if i != len(fields)-1 {
+					return nil, fmt.Errorf("placeholder (%s) of type rest must be the last token", field)
+				}
+				token.tokenType = restPlaceholder
+			default:
+				if !strings.Contains(nameAndType[1], "|") {
+					return nil, fmt.Errorf("placeholder (%s) has unknown type (%s)", field, nameAndType[1])
+				}
+				token.tokenType = choicePlaceholder
+				token.choices = strings.Split(nameAndType[1], "|")
+			}
+		}
+
+		token.matcher = regexp.MustCompile("^(?:" + token.regexpPattern() + ")$")
+		parsed.tokens = append(parsed.tokens, token)
+	}
+
+	return parsed, nil
+}
+
+func (token *grammarToken) regexpPattern() string {
+	switch token.tokenType {
+	case literalToken:
+		return regexp.QuoteMeta(token.text)
+	case choicePlaceholder:
+		quotedChoices := make([]string, len(token.choices))
+		for i, choice := range token.choices {
+			quotedChoices[i] = regexp.QuoteMeta(choice)
+		}
+		return strings.Join(quotedChoices, "|")
+	default:
+		return patternForGrammarTokenType[token.tokenType]
+	}
+}
+
+// asRegexp produces the regular expression equivalent of the grammar.  Each placeholder becomes a capture
+// group, so match groups are delivered to callbacks just as they are for a regular expression matcher.
+func (grammar *commandGrammar) asRegexp() *regexp.Regexp {
+	tokenPatterns := make([]string, len(grammar.tokens))
+	for i, token := range grammar.tokens {
+		if token.tokenType == literalToken {
+			tokenPatterns[i] = token.regexpPattern()
+		} else {
+			tokenPatterns[i] = "(" + token.regexpPattern() + ")"
+		}
+	}
+
+	return regexp.MustCompile(`^\s*` + strings.Join(tokenPatterns, `\s+`) + `\s*$`)
+}
+
+// indexOfNextTokenAfter returns the index of the token that would follow the provided completed words, or -1 if
+// the words do not conform to the grammar.  If a rest placeholder has already been reached, its index is returned.
+func (grammar *commandGrammar) indexOfNextTokenAfter(completedWords []string) int {
+	for i, word := range completedWords {
+		if i >= len(grammar.tokens) {
+			return -1
+		}
+		if grammar.tokens[i].tokenType == restPlaceholder {
+			return i
+		}
+		if !grammar.tokens[i].acceptsWord(word) {
+			return -1
+		}
+	}
+
+	return len(completedWords)
+}
+
+// splitAtCursor divides the text before the cursor into the words that are complete (i.e., followed by whitespace)
+// and the partial word immediately before the cursor (which may be empty).
+func splitAtCursor(currentLine string, cursorPosition int) (completedWords []string, partialWord string) {
+	if cursorPosition > len(currentLine) {
+		cursorPosition = len(currentLine)
+	}
+
+	textBeforeCursor := currentLine[:cursorPosition]
+	completedWords = strings.Fields(textBeforeCursor)
+
+	if len(completedWords) > 0 && strings.TrimRight(textBeforeCursor, " \t") == textBeforeCursor {
+		partialWord = completedWords[len(completedWords)-1]
+		completedWords = completedWords[:len(completedWords)-1]
+	}
+
+	return completedWords, partialWord
+}
+
+// WhenCommandFollowsGrammar adds a matcher with its callback, like WhenCommandMatches, but the matcher is described
+// by a declarative grammar rather than a regular expression.  A grammar is a sequence of whitespace separated tokens.
+// A token that is not enclosed in angle brackets is a literal keyword.  A token enclosed in angle brackets is a typed
+// placeholder of the form <name> or <name:type>, where type is one of "word" (the default, any run of non-whitespace),
+// "int", "float", "rest" (everything to the end of the command, allowed only as the last token), or a set of choices
+// separated by '|' (e.g., <state:on|off>).  Tokens may be separated by any amount of whitespace in a command.  The
+// callback receives the full command followed by the value for each placeholder, in order.  For example, the grammar
+// "read <count:int> lines from <path:rest>" would match "read 10 lines from /tmp/x y", and the callback would receive
+// []string{"read 10 lines from /tmp/x y", "10", "/tmp/x y"}.  If the grammar is invalid, this method panics.
+//
+// Because the processor understands the structure of grammar commands, it can supply completion candidates
+// (CompletionCandidatesFor), argument hints (ArgumentHintFor) and usage strings (UsageStrings) for them.
+func (processor *CommandProcessor) WhenCommandFollowsGrammar(grammar string, doCallback func([]string) error) *CommandProcessor {
+	parsedGrammar, err := parseCommandGrammar(grammar)
+	if err != nil {
+		panic(fmt.Sprintf("WhenCommandFollowsGrammar invoked with an invalid grammar: %s", err.Error()))
+	}
+
+	processor.matchersInOrderProvided = append(processor.matchersInOrderProvided, &matcher{
+		pattern:  parsedGrammar.asRegexp(),
+		grammar:  parsedGrammar,
+		callback: doCallback,
+		documentation: &commandDocumentation{
+			name:     parsedGrammar.tokens[0].text,
+			synopsis: parsedGrammar.asProvided,
+		},
+	})
+
+	return processor
+}
+
+// CompletionCandidatesFor returns the set of possible completions for the word immediately before the cursor, based
+// on commands added using WhenCommandFollowsGrammar.  Literal keywords and placeholder choices are offered when they
+// may follow the words already entered.  The cursorPosition is a byte offset into currentLine.  This method is a
+// Completer, so it may be passed directly to Tpcli.CompletingCommandsUsing().
+func (processor *CommandProcessor) CompletionCandidatesFor(currentLine string, cursorPosition int) []string {
+	completedWords, partialWord := splitAtCursor(currentLine, cursorPosition)
+
+	candidates := []string{}
+	candidateAlreadyOffered := make(map[string]bool)
+
+	for _, matcher := range processor.matchersInOrderProvided {
+		if matcher.grammar == nil {
+			continue
+		}
+
+		indexOfNextToken := matcher.grammar.indexOfNextTokenAfter(completedWords)
+		if indexOfNextToken < 0 || indexOfNextToken >= len(matcher.grammar.tokens) {
+			continue
+		}
+
+		for _, candidate := range matcher.grammar.tokens[indexOfNextToken].completionCandidatesFor(partialWord) {
+			if !candidateAlreadyOffered[candidate] {
+				candidates = append(candidates, candidate)
+				candidateAlreadyOffered[candidate] = true
+			}
+		}
+	}
+
+	return candidates
+}
+
+// ArgumentHintFor returns the portion of a grammar that remains to be entered, given the text before the cursor.  For
+// example, if a grammar is "read <count:int> lines from <path:rest>" and the text before the cursor is "read 10 ", the
+// hint is "lines from <path:rest>".  If the text does not conform to exactly one grammar command, or nothing remains
+// to be entered, the hint is the empty string.  The cursorPosition is a byte offset into currentLine.  This method may
+// be passed directly to Tpcli.HintingCommandsUsing().
+func (processor *CommandProcessor) ArgumentHintFor(currentLine string, cursorPosition int) string {
+	completedWords, partialWord := splitAtCursor(currentLine, cursorPosition)
+
+	hint := ""
+	numberOfConformingGrammars := 0
+
+	for _, matcher := range processor.matchersInOrderProvided {
+		if matcher.grammar == nil {
+			continue
+		}
+
+		tokens := matcher.grammar.tokens
+
+		indexOfNextToken := matcher.grammar.indexOfNextTokenAfter(completedWords)
+		if indexOfNextToken < 0 || (indexOfNextToken >= len(tokens) && partialWord != "") {
+			continue
+		}
+
+		if indexOfNextToken < len(tokens) && tokens[indexOfNextToken].tokenType == restPlaceholder && len(completedWords) > indexOfNextToken {
+			numberOfConformingGrammars++
+			hint = ""
+			continue
+		}
+
+		if partialWord != "" {
+			if !tokens[indexOfNextToken].acceptsPartialWord(partialWord) {
+				continue
+			}
+			indexOfNextToken++
+		}
+
+		numberOfConformingGrammars++
+
+		remainingTokens := make([]string, 0, len(tokens))
+		for _, token := range tokens[indexOfNextToken:] {
+			remainingTokens = append(remainingTokens, token.text)
+		}
+		hint = strings.Join(remainingTokens, " ")
+	}
+
+	if numberOfConformingGrammars != 1 {
+		return ""
+	}
+
+	return hint
+}
+
+// UsageStrings returns the grammar for each command added using WhenCommandFollowsGrammar, in the order in which
+// they were added.  Commands added with a regular expression have no usage string.
+func (processor *CommandProcessor) UsageStrings() []string {
+	usageStrings := make([]string, 0, len(processor.matchersInOrderProvided))
+
+	for _, matcher := range processor.matchersInOrderProvided {
+		if matcher.grammar != nil {
+			usageStrings = append(usageStrings, matcher.grammar.asProvided)
+		}
+	}
+
+	return usageStrings
+}
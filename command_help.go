@@ -0,0 +1,120 @@
+package tpcli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type commandDocumentation struct {
+	name        string
+	synopsis    string
+	description string
+}
+
+// WhenDocumentedCommandMatches is the same as WhenCommandMatches, but it also records documentation for the command,
+// which is used by the help command (see ProvidingHelpCommandWritingTo).  'name' is the name by which the command is
+// requested in "help <name>".  'synopsis' is a short form of the command showing its arguments (e.g., "read <file>").
+// 'description' explains what the command does.  Only the first line of the description is shown in the command listing.
+func (processor *CommandProcessor) WhenDocumentedCommandMatches(name string, synopsis string, description string, pattern interface{}, doCallback func([]string) error) *CommandProcessor {
+	processor.WhenCommandMatches(pattern, doCallback)
+	processor.documentMostRecentMatcher(name, synopsis, description)
+	return processor
+}
+
+// WhenDocumentedCommandFollowsGrammar is the same as WhenCommandFollowsGrammar, but it also records a description for
+// the command, which is used by the help command (see ProvidingHelpCommandWritingTo).  A command added using
+// WhenCommandFollowsGrammar is also listed by the help command, but without a description.  For grammar commands, the
+// name is the first token of the grammar and the synopsis is the grammar itself.
+func (processor *CommandProcessor) WhenDocumentedCommandFollowsGrammar(grammar string, description string, doCallback func([]string) error) *CommandProcessor {
+	processor.WhenCommandFollowsGrammar(grammar, doCallback)
+	processor.matchersInOrderProvided[len(processor.matchersInOrderProvided)-1].documentation.description = description
+	return processor
+}
+
+// ProvidingHelpCommandWritingTo adds the built-in commands "help" and "help <command>".  The first writes a listing of
+// each documented command (and each grammar command) with its synopsis.  The second writes the synopsis and full
+// description for the named command.  Output is written to 'writer', which will commonly be a Tpcli (so that the output
+// appears in the general output panel).  The help commands are matched in the order this method is invoked relative to
+// other matchers, so it is usually best to invoke it after all other commands are added.
+func (processor *CommandProcessor) ProvidingHelpCommandWritingTo(writer io.Writer) *CommandProcessor {
+	return processor.
+		WhenDocumentedCommandMatches("help", "help [<command>]", "Show the available commands, or describe a single command", `^\s*help\s*$`, func([]string) error {
+			return processor.WriteHelpTo(writer, "")
+		}).
+		WhenCommandMatches(`^\s*help\s+(\S+)\s*$`, func(matchGroups []string) error {
+			return processor.WriteHelpTo(writer, matchGroups[1])
+		})
+}
+
+// WriteHelpTo writes help text to the writer.  If commandName is the empty string, a listing of all documented
+// commands is written.  Otherwise, the synopsis and description for each command with that name are written.  If
+// there is no documented command with that name, an error is returned and nothing is written.  The help text is
+// delivered in a single Write, without a trailing newline, because a Tpcli separates each write from the text before
+// it with a newline.
+func (processor *CommandProcessor) WriteHelpTo(writer io.Writer, commandName string) error {
+	var helpText bytes.Buffer
+
+	if commandName == "" {
+		processor.writeCommandListingTo(&helpText)
+	} else if err := processor.writeCommandDescriptionTo(&helpText, commandName); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(bytes.TrimSuffix(helpText.Bytes(), []byte("\n")))
+	return err
+}
+
+func (processor *CommandProcessor) writeCommandListingTo(helpText *bytes.Buffer) {
+	fmt.Fprintln(helpText, "Commands:")
+
+	var alignedListing bytes.Buffer
+	tabWriter := tabwriter.NewWriter(&alignedListing, 0, 4, 3, ' ', 0)
+	for _, matcher := range processor.matchersInOrderProvided {
+		if matcher.documentation == nil {
+			continue
+		}
+		firstLineOfDescription := strings.SplitN(matcher.documentation.description, "\n", 2)[0]
+		fmt.Fprintf(tabWriter, "  %s\t%s\n", matcher.documentation.synopsis, firstLineOfDescription)
+	}
+	tabWriter.Flush()
+
+	// Commands without a description would otherwise be padded with trailing spaces
+	for _, line := range strings.SplitAfter(alignedListing.String(), "\n") {
+		if line != "" {
+			fmt.Fprintln(helpText, strings.TrimRight(line, " \n"))
+		}
+	}
+}
+
+func (processor *CommandProcessor) writeCommandDescriptionTo(helpText *bytes.Buffer, commandName string) error {
+	for _, matcher := range processor.matchersInOrderProvided {
+		if matcher.documentation == nil || matcher.documentation.name != commandName {
+			continue
+		}
+
+		if helpText.Len() > 0 {
+			fmt.Fprintln(helpText)
+		}
+		fmt.Fprintf(helpText, "Usage: %s\n", matcher.documentation.synopsis)
+		if matcher.documentation.description != "" {
+			fmt.Fprintf(helpText, "\n%s\n", matcher.documentation.description)
+		}
+	}
+
+	if helpText.Len() == 0 {
+		return fmt.Errorf("no help for command (%s)", commandName)
+	}
+
+	return nil
+}
+
+func (processor *CommandProcessor) documentMostRecentMatcher(name string, synopsis string, description string) {
+	processor.matchersInOrderProvided[len(processor.matchersInOrderProvided)-1].documentation = &commandDocumentation{
+		name:        name,
+		synopsis:    synopsis,
+		description: description,
+	}
+}
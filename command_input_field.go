@@ -0,0 +1,322 @@
+package tpcli
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// commandInputField is a single row tview primitive used for command entry.  It is much like a
+// tview.InputField, but it exposes the underlying lineEditor, so that the command input panel
+// can act on the cursor position (e.g., for completion).  It supports the basic shell-emacs
+// bindings, including a kill ring.
+type commandInputField struct {
+	*tview.Box
+	editor               *lineEditor
+	label                string
+	labelColor           tcell.Color
+	fieldBackgroundColor tcell.Color
+	fieldTextColor       tcell.Color
+	hintTextColor        tcell.Color
+	hintFor              ArgumentHinter
+	offsetOfFirstVisible int // in the line containing the cursor
+	firstVisibleLine     int
+	callbackOnDone       func(key tcell.Key)
+	callbackOnChange     func(text string)
+	killRing             *killRing
+	mostRecentEdit       editKind
+	yankedTextStart      int // rune index of the start of the most recently yanked text
+}
+
+// editKind is used to determine whether a kill should be accumulated with the previous kill, and whether M-y
+// may replace the previous yank.
+type editKind int
+
+const (
+	otherEdit editKind = iota
+	killEdit
+	yankEdit
+)
+
+// killDirection indicates whether a kill removed text before or after the cursor, which determines where the killed
+// text is added when it is accumulated with the previous kill.
+type killDirection int
+
+const (
+	killedTextBeforeCursor killDirection = iota
+	killedTextAfterCursor
+)
+
+const maximumKillRingEntries = 10
+
+func newCommandInputField() *commandInputField {
+	return &commandInputField{
+		Box:                  tview.NewBox(),
+		editor:               newLineEditor(),
+		labelColor:           tview.Styles.SecondaryTextColor,
+		fieldBackgroundColor: tview.Styles.ContrastBackgroundColor,
+		fieldTextColor:       tview.Styles.PrimaryTextColor,
+		hintTextColor:        tcell.ColorGray,
+		callbackOnDone:       func(tcell.Key) {},
+		callbackOnChange:     func(string) {},
+		killRing:             newKillRing(maximumKillRingEntries),
+		mostRecentEdit:       otherEdit,
+	}
+}
+
+func (field *commandInputField) SetLabel(label string) *commandInputField {
+	field.label = label
+	return field
+}
+
+func (field *commandInputField) SetLabelColor(color tcell.Color) *commandInputField {
+	field.labelColor = color
+	return field
+}
+
+func (field *commandInputField) SetFieldBackgroundColor(color tcell.Color) *commandInputField {
+	field.fieldBackgroundColor = color
+	return field
+}
+
+func (field *commandInputField) SetFieldTextColor(color tcell.Color) *commandInputField {
+	field.fieldTextColor = color
+	return field
+}
+
+func (field *commandInputField) SetHintTextColor(color tcell.Color) *commandInputField {
+	field.hintTextColor = color
+	return field
+}
+
+func (field *commandInputField) SetDoneFunc(handler func(key tcell.Key)) *commandInputField {
+	field.callbackOnDone = handler
+	return field
+}
+
+// SetChangedFunc sets a handler which is called whenever the text changes, whether by editing or by SetText.
+func (field *commandInputField) SetChangedFunc(handler func(text string)) *commandInputField {
+	field.callbackOnChange = handler
+	return field
+}
+
+func (field *commandInputField) SetHintFunc(hinter ArgumentHinter) *commandInputField {
+	field.hintFor = hinter
+	return field
+}
+
+func (field *commandInputField) SetText(text string) *commandInputField {
+	field.editor.SetText(text)
+	field.mostRecentEdit = otherEdit
+	field.callbackOnChange(text)
+	return field
+}
+
+// Insert adds text at the cursor, leaving the cursor after it.
+func (field *commandInputField) Insert(text string) *commandInputField {
+	field.editor.Insert(text)
+	field.mostRecentEdit = otherEdit
+	field.callbackOnChange(field.editor.Text())
+	return field
+}
+
+func (field *commandInputField) GetText() string {
+	return field.editor.Text()
+}
+
+func (field *commandInputField) Draw(screen tcell.Screen) {
+	field.Box.DrawForSubclass(screen, field)
+
+	x, y, width, height := field.GetInnerRect()
+	rightLimit := x + width
+	if height < 1 || width < 1 {
+		return
+	}
+
+	lines, cursorLine, cursorColumnInLine := field.editor.Lines()
+
+	if cursorLine < field.firstVisibleLine {
+		field.firstVisibleLine = cursorLine
+	}
+	if cursorLine >= field.firstVisibleLine+height {
+		field.firstVisibleLine = cursorLine - height + 1
+	}
+
+	// Lines after the first are aligned with the first, which follows the label
+	textX := x + tview.TaggedStringWidth(field.label)
+	fieldStyle := tcell.StyleDefault.Background(field.fieldBackgroundColor).Foreground(field.fieldTextColor)
+
+	for row := 0; row < height && field.firstVisibleLine+row < len(lines); row++ {
+		lineIndex := field.firstVisibleLine + row
+		line := lines[lineIndex]
+		rowY := y + row
+
+		if lineIndex == 0 {
+			tview.Print(screen, field.label, x, rowY, width, tview.AlignLeft, field.labelColor)
+		}
+
+		for column := textX; column < rightLimit; column++ {
+			screen.SetContent(column, rowY, ' ', nil, fieldStyle)
+		}
+
+		fieldWidth := rightLimit - textX
+		if fieldWidth < 1 {
+			return
+		}
+
+		offsetOfFirstVisible := 0
+		if lineIndex == cursorLine {
+			if cursorColumnInLine < field.offsetOfFirstVisible {
+				field.offsetOfFirstVisible = cursorColumnInLine
+			}
+			for field.offsetOfFirstVisible < cursorColumnInLine && displayWidthOf(line[field.offsetOfFirstVisible:cursorColumnInLine]) >= fieldWidth {
+				field.offsetOfFirstVisible++
+			}
+			offsetOfFirstVisible = field.offsetOfFirstVisible
+		}
+
+		column := textX
+		for index := offsetOfFirstVisible; index < len(line) && column < rightLimit; index++ {
+			screen.SetContent(column, rowY, line[index], nil, fieldStyle)
+			column += displayWidthOf(line[index : index+1])
+		}
+
+		if lineIndex != cursorLine {
+			continue
+		}
+
+		if field.HasFocus() {
+			screen.ShowCursor(textX+displayWidthOf(line[offsetOfFirstVisible:cursorColumnInLine]), rowY)
+		}
+
+		if field.hintFor != nil && field.editor.CursorIsAtEnd() {
+			if hint := field.hintFor(field.editor.Text(), field.editor.CursorByteOffset()); hint != "" {
+				if len(line) > 0 && line[len(line)-1] != ' ' {
+					column++
+				}
+				if column < rightLimit {
+					tview.Print(screen, tview.Escape(hint), column, rowY, rightLimit-column, tview.AlignLeft, field.hintTextColor)
+				}
+			}
+		}
+	}
+}
+
+func displayWidthOf(runes []rune) int {
+	return tview.TaggedStringWidth(tview.Escape(string(runes)))
+}
+
+func (field *commandInputField) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	return field.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+		editor := field.editor
+
+		previousEdit := field.mostRecentEdit
+		field.mostRecentEdit = otherEdit
+
+		textBeforeEdit := editor.Text()
+		defer func() {
+			if textAfterEdit := editor.Text(); textAfterEdit != textBeforeEdit {
+				field.callbackOnChange(textAfterEdit)
+			}
+		}()
+
+		switch event.Key() {
+		case tcell.KeyRune:
+			if event.Modifiers()&tcell.ModAlt != 0 {
+				switch event.Rune() {
+				case 'a':
+					editor.MoveToStart()
+				case 'e':
+					editor.MoveToEnd()
+				case 'b':
+					editor.MoveWordLeft()
+				case 'f':
+					editor.MoveWordRight()
+				case 'y':
+					if previousEdit == yankEdit {
+						field.replaceYankedTextWithOlderKill()
+					}
+				}
+			} else {
+				editor.Insert(string(event.Rune()))
+			}
+		case tcell.KeyLeft:
+			if event.Modifiers()&tcell.ModAlt != 0 {
+				editor.MoveWordLeft()
+			} else {
+				editor.MoveLeft()
+			}
+		case tcell.KeyRight:
+			if event.Modifiers()&tcell.ModAlt != 0 {
+				editor.MoveWordRight()
+			} else {
+				editor.MoveRight()
+			}
+		case tcell.KeyCtrlB:
+			editor.MoveLeft()
+		case tcell.KeyCtrlF:
+			editor.MoveRight()
+		case tcell.KeyHome, tcell.KeyCtrlA:
+			editor.MoveToStartOfLine()
+		case tcell.KeyEnd, tcell.KeyCtrlE:
+			editor.MoveToEndOfLine()
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			editor.DeleteBackward()
+		case tcell.KeyDelete, tcell.KeyCtrlD:
+			editor.DeleteForward()
+		case tcell.KeyCtrlK:
+			field.kill(editor.DeleteToEnd(), killedTextAfterCursor, previousEdit)
+		case tcell.KeyCtrlU:
+			field.kill(editor.DeleteToStart(), killedTextBeforeCursor, previousEdit)
+		case tcell.KeyCtrlW:
+			field.kill(editor.DeleteWordBeforeCursor(), killedTextBeforeCursor, previousEdit)
+		case tcell.KeyCtrlY:
+			field.yank()
+		case tcell.KeyEnter, tcell.KeyTab, tcell.KeyBacktab, tcell.KeyEscape:
+			field.callbackOnDone(event.Key())
+		}
+	})
+}
+
+// kill adds killed text to the kill ring.  If the previous edit was also a kill, the text is accumulated into the most
+// recent entry (so that, for example, ^w^w yanks back both words).
+func (field *commandInputField) kill(killedText string, direction killDirection, previousEdit editKind) {
+	if killedText == "" {
+		if previousEdit == killEdit {
+			field.mostRecentEdit = killEdit
+		}
+		return
+	}
+
+	field.mostRecentEdit = killEdit
+
+	switch {
+	case previousEdit != killEdit:
+		field.killRing.Push(killedText)
+	case direction == killedTextAfterCursor:
+		field.killRing.AppendToMostRecent(killedText)
+	default:
+		field.killRing.PrependToMostRecent(killedText)
+	}
+}
+
+func (field *commandInputField) yank() {
+	if text, ok := field.killRing.Yank(); ok {
+		field.yankedTextStart = field.editor.cursor
+		field.editor.Insert(text)
+		field.mostRecentEdit = yankEdit
+	}
+}
+
+// replaceYankedTextWithOlderKill replaces the text inserted by the most recent yank with the next older entry in the
+// kill ring.  If the yanked text is no longer immediately before the cursor, nothing is done.
+func (field *commandInputField) replaceYankedTextWithOlderKill() {
+	yankedText := []rune(field.killRing.CurrentlyYanked())
+	if field.editor.cursor-field.yankedTextStart != len(yankedText) || string(field.editor.text[field.yankedTextStart:field.editor.cursor]) != string(yankedText) {
+		return
+	}
+
+	if text, ok := field.killRing.RotateAndYank(); ok {
+		field.editor.ReplaceBetween(field.yankedTextStart, field.editor.cursor, text)
+		field.mostRecentEdit = yankEdit
+	}
+}
@@ -6,8 +6,10 @@ import (
 )
 
 type matcher struct {
-	pattern  *regexp.Regexp
-	callback func([]string) error
+	pattern       *regexp.Regexp
+	grammar       *commandGrammar // nil unless the matcher was added using WhenCommandFollowsGrammar
+	documentation *commandDocumentation
+	callback      func([]string) error
 }
 
 // CommandProcessor is a helper for processing user commands input in the Tpcli command entry panel.
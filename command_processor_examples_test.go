@@ -48,3 +48,30 @@ func ExampleCommandProcessor() {
 		}
 	}
 }
+
+// Commands described by grammars can feed completion and argument hints to the Tpcli
+func ExampleCommandProcessor_WhenCommandFollowsGrammar() {
+	cp := tpcli.NewCommandProcessor().
+		WhenCommandFollowsGrammar("connect to <host> port <port:int>", func(matchGroups []string) error {
+			fmt.Printf("Connecting to %s:%s\n", matchGroups[1], matchGroups[2])
+			return nil
+		}).
+		WhenCommandFollowsGrammar("set tracing <state:on|off>", func(matchGroups []string) error {
+			fmt.Printf("Tracing is now %s\n", matchGroups[1])
+			return nil
+		})
+
+	cp.ProcessCommandString("connect to example.com port 8080")
+
+	fmt.Println(cp.CompletionCandidatesFor("set tracing o", 13))
+	fmt.Println(cp.ArgumentHintFor("connect to example.com ", 23))
+
+	tpcli.NewUI().
+		CompletingCommandsUsing(cp.CompletionCandidatesFor).
+		HintingCommandsUsing(cp.ArgumentHintFor)
+
+	// Output:
+	// Connecting to example.com:8080
+	// [on off]
+	// port <port:int>
+}
@@ -1,6 +1,7 @@
 package tpcli_test
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 
@@ -124,3 +125,140 @@ var _ = Describe("CommandProcessor", func() {
 		})
 	})
 })
+
+var _ = Describe("CommandProcessor with grammars", func() {
+	var (
+		processor *tpcli.CommandProcessor
+		callback  *commandProcessorCallbacks
+	)
+
+	BeforeEach(func() {
+		callback = &commandProcessorCallbacks{}
+		processor = tpcli.NewCommandProcessor().
+			WhenCommandFollowsGrammar("quit", callback.OnQuit).
+			WhenCommandFollowsGrammar("read <count:int> lines from <path:rest>", callback.OnRead).
+			WhenCommandFollowsGrammar("read <name> from file <path:rest>", callback.OnRead).
+			WhenCommandFollowsGrammar("set tracing <state:on|off>", callback.OnCompile).
+			WhenCommandMatches(`^reload$`, callback.OnCompile)
+	})
+
+	JustBeforeEach(func() {
+		callback.Reset()
+	})
+
+	Describe("Matching commands", func() {
+		It("should deliver placeholder values as match groups", func() {
+			matchesAnyMatcher, err := processor.ProcessCommandString("read  10 lines from /foo/bar baz.txt")
+			Expect(matchesAnyMatcher).To(BeTrue())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(callback.nameOfLastCallback).To(Equal("OnRead"))
+			Expect(callback.matchGroupsFromLastCallbacks).To(Equal([]string{"read  10 lines from /foo/bar baz.txt", "10", "/foo/bar baz.txt"}))
+		})
+
+		It("should enforce placeholder types", func() {
+			matchesAnyMatcher, _ := processor.ProcessCommandString("set tracing maybe")
+			Expect(matchesAnyMatcher).To(BeFalse())
+
+			matchesAnyMatcher, _ = processor.ProcessCommandString("set tracing off")
+			Expect(matchesAnyMatcher).To(BeTrue())
+			Expect(callback.matchGroupsFromLastCallbacks).To(Equal([]string{"set tracing off", "off"}))
+		})
+
+		It("should panic on an invalid grammar", func() {
+			Expect(func() { processor.WhenCommandFollowsGrammar("read <path:rest> now", callback.OnRead) }).To(Panic())
+			Expect(func() { processor.WhenCommandFollowsGrammar("read <count:integer>", callback.OnRead) }).To(Panic())
+		})
+	})
+
+	Describe("Completion candidates", func() {
+		It("should offer the first keyword of each grammar command", func() {
+			Expect(processor.CompletionCandidatesFor("", 0)).To(Equal([]string{"quit", "read", "set"}))
+			Expect(processor.CompletionCandidatesFor("re", 2)).To(Equal([]string{"read"}))
+		})
+
+		It("should offer keywords and choices that may follow the words already entered", func() {
+			Expect(processor.CompletionCandidatesFor("set ", 4)).To(Equal([]string{"tracing"}))
+			Expect(processor.CompletionCandidatesFor("set tracing o", 13)).To(Equal([]string{"on", "off"}))
+			Expect(processor.CompletionCandidatesFor("read 10 l", 9)).To(Equal([]string{"lines"}))
+			Expect(processor.CompletionCandidatesFor("read foo f", 10)).To(Equal([]string{"from"}))
+		})
+
+		It("should offer nothing for placeholders or non-conforming commands", func() {
+			Expect(processor.CompletionCandidatesFor("read ", 5)).To(BeEmpty())
+			Expect(processor.CompletionCandidatesFor("write ", 6)).To(BeEmpty())
+		})
+
+		It("should only consider the text before the cursor", func() {
+			Expect(processor.CompletionCandidatesFor("set tr foo", 6)).To(Equal([]string{"tracing"}))
+		})
+	})
+
+	Describe("Argument hints and usage", func() {
+		It("should hint the remainder of the single conforming grammar", func() {
+			Expect(processor.ArgumentHintFor("read foo ", 9)).To(Equal("from file <path:rest>"))
+			Expect(processor.ArgumentHintFor("read 10 li", 10)).To(Equal("from <path:rest>"))
+			Expect(processor.ArgumentHintFor("set", 3)).To(Equal("tracing <state:on|off>"))
+		})
+
+		It("should not hint when the grammar is ambiguous, complete or not matched", func() {
+			Expect(processor.ArgumentHintFor("read ", 5)).To(Equal(""))
+			Expect(processor.ArgumentHintFor("read 10 ", 8)).To(Equal(""))
+			Expect(processor.ArgumentHintFor("quit", 4)).To(Equal(""))
+			Expect(processor.ArgumentHintFor("write ", 6)).To(Equal(""))
+		})
+
+		It("should provide the grammar of each grammar command as a usage string", func() {
+			Expect(processor.UsageStrings()).To(Equal([]string{
+				"quit",
+				"read <count:int> lines from <path:rest>",
+				"read <name> from file <path:rest>",
+				"set tracing <state:on|off>",
+			}))
+		})
+	})
+})
+
+var _ = Describe("CommandProcessor help", func() {
+	var (
+		processor  *tpcli.CommandProcessor
+		callback   *commandProcessorCallbacks
+		helpOutput *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		callback = &commandProcessorCallbacks{}
+		helpOutput = new(bytes.Buffer)
+		processor = tpcli.NewCommandProcessor().
+			WhenDocumentedCommandMatches("quit", "quit", "Exit the application", `^quit$`, callback.OnQuit).
+			WhenDocumentedCommandFollowsGrammar("read <name> from file <path:rest>", "Read a named value from a file.\nThe file must exist.", callback.OnRead).
+			WhenCommandFollowsGrammar("compile <count:int>", callback.OnCompile).
+			WhenCommandMatches(`^undocumented$`, callback.OnCompile).
+			ProvidingHelpCommandWritingTo(helpOutput)
+	})
+
+	It("should list every documented and grammar command on 'help'", func() {
+		matchesAnyMatcher, err := processor.ProcessCommandString("help")
+		Expect(matchesAnyMatcher).To(BeTrue())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(helpOutput.String()).To(Equal(
+			"Commands:\n" +
+				"  quit                                Exit the application\n" +
+				"  read <name> from file <path:rest>   Read a named value from a file.\n" +
+				"  compile <count:int>\n" +
+				"  help [<command>]                    Show the available commands, or describe a single command"))
+	})
+
+	It("should describe a single command on 'help <command>'", func() {
+		matchesAnyMatcher, err := processor.ProcessCommandString("help read")
+		Expect(matchesAnyMatcher).To(BeTrue())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(helpOutput.String()).To(Equal("Usage: read <name> from file <path:rest>\n\nRead a named value from a file.\nThe file must exist."))
+	})
+
+	It("should return an error for 'help' on an unknown command", func() {
+		matchesAnyMatcher, err := processor.ProcessCommandString("help undocumented")
+		Expect(matchesAnyMatcher).To(BeTrue())
+		Expect(err).Should(MatchError("no help for command (undocumented)"))
+		Expect(helpOutput.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,80 @@
+package tpcli
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Completer supplies completion candidates for the command input panel.  It is given the current text
+// of the command input panel and the position of the cursor as a byte offset into that text.  It returns
+// the set of candidates for the word immediately preceding the cursor (that is, the text between the last
+// whitespace before the cursor and the cursor itself).  Each candidate is a full replacement for that
+// word, not just the remaining suffix.  An empty or nil set means there is no completion.
+type Completer func(currentLine string, cursorPosition int) (candidates []string)
+
+// CompletingCommandsUsing enables <tab> completion in the command input panel.  When the user hits <tab>,
+// the completer is invoked.  If it returns a single candidate, the word before the cursor is replaced with it
+// (followed by a space if the cursor is at the end of the line).  If it returns more than one candidate, the
+// word before the cursor is extended to the longest prefix that all candidates share.  If it cannot be extended,
+// the candidates are listed in the general output panel.  Because <tab> is consumed by the command input panel
+// when completion is enabled, <shift>-<tab> must be used to move focus away from it.
+func (ui *Tpcli) CompletingCommandsUsing(completer Completer) *Tpcli {
+	ui.commandCompleter = completer
+	return ui
+}
+
+// ArgumentHinter supplies a hint that is shown, dimmed, after the text in the command input panel when the cursor
+// is at the end of the text.  Like a Completer, it is given the current text of the command input panel and the
+// position of the cursor as a byte offset into that text.  The hint typically describes the arguments that remain to
+// be entered.  If it returns the empty string, no hint is shown.
+type ArgumentHinter func(currentLine string, cursorPosition int) (hint string)
+
+// HintingCommandsUsing instructs the Tpcli to show the hint supplied by the hinter after the text in the command input
+// panel.  The hint is re-evaluated each time the command input panel is drawn.
+func (ui *Tpcli) HintingCommandsUsing(hinter ArgumentHinter) *Tpcli {
+	ui.commandHinter = hinter
+	return ui
+}
+
+func (panel *commandInputPanel) completeWordBeforeCursor() {
+	editor := panel.inputField.editor
+
+	candidates := panel.completer(editor.Text(), editor.CursorByteOffset())
+	if len(candidates) == 0 {
+		return
+	}
+
+	wordBeforeCursor, startOfWord := editor.WordBeforeCursor()
+
+	if len(candidates) == 1 {
+		replacement := candidates[0]
+		if editor.CursorIsAtEnd() {
+			replacement += " "
+		}
+		editor.ReplaceBetween(startOfWord, editor.cursor, replacement)
+		return
+	}
+
+	if commonPrefix := longestCommonPrefixOf(candidates); len(commonPrefix) > len(wordBeforeCursor) && strings.HasPrefix(commonPrefix, wordBeforeCursor) {
+		editor.ReplaceBetween(startOfWord, editor.cursor, commonPrefix)
+		return
+	}
+
+	panel.callbackOnMultipleCompletionCandidates(candidates)
+}
+
+func longestCommonPrefixOf(set []string) string {
+	if len(set) == 0 {
+		return ""
+	}
+
+	prefix := set[0]
+	for _, s := range set[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, widthOfLastRune := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-widthOfLastRune]
+		}
+	}
+
+	return prefix
+}
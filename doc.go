@@ -9,9 +9,19 @@
 // entry panel, a general output panel and third panel that is either for error
 // output or which records the history of entered commands.
 //
-// The command entry panel starts with focus.  It is a single row panel which supports
+// The command entry panel starts with focus.  It is a single row panel (unless multi-line
+// input is enabled with UsingMultiLineCommandInput(), in which case it grows as lines
+// are added to an incomplete command) which supports
 // basic shell-emacs bindings (e.g., ^a to go to the start of the line, ^e to the end
-// of the line) and arrow key readline-style history navigation.
+// of the line, ^k, ^u and ^w to kill text, ^y to yank it back and M-y to rotate through earlier
+// kills) and arrow key readline-style history navigation.  The command history may be kept
+// in a file between sessions (see UsingCommandHistoryFile()).  ^r starts a bash-style reverse incremental
+// search of the command history: typed characters refine the search, ^r steps further back, <enter>
+// accepts the match and <esc> or ^g cancels the search.  Policies like bash's HISTCONTROL determine
+// which commands are recorded in the history (see ControllingCommandHistoryWith() and
+// IgnoringCommandsInHistoryMatching()).  Vi editing, with insert and normal states, may be used
+// instead of shell-emacs editing (see UsingViEditingMode()).  The prompt may be changed at any
+// time, and may include tview color tags (see ChangePromptTo() and UsingPromptProvider()).
 //
 // The UI runs is started as a goroutine.  When the user enters a string in the command entry panel and hits
 // <enter>, the command string is delivered on a channel.  Text may be written to the
@@ -19,20 +29,65 @@
 // error output panel.  It is just like the general output panel, and differs only semantically.
 // It may alternatively be set to command history panel.  In this case, every time the user
 // enters a command string, it is appended to this panel, providing a command history.
+// Text may be written from any goroutine.  Writes are batched, so that the UI is redrawn at most
+// 30 times per second however quickly text arrives (see LimitingRedrawsTo()).  The command string
+// and prompt may likewise be changed from any goroutine, including from a key binding callback.  An output panel may be
+// limited to a number of lines, beyond which the oldest are dropped (see LimitingPanelLinesTo()).
+// Each line may be preceded by the time it was written (see TimestampingPanelLinesUsing()) and by
+// a tag naming its source, such as "[peer]" (see ShowingSourceTagsIn()).  ANSI color sequences in
+// the text (e.g., from "ls --color") may be shown as colors (see TranslatingANSIIn()).  Text may be
+// written at an OutputLevel (see AddLeveledStringToGeneralOutput()), which sets its style (see
+// StylingOutputLevelUsing()) and may hide it (see ShowingOutputAtOrAboveLevel()).  Colors and
+// styles are set by a Theme (see UsingTheme()).  The height of each panel is a fixed number of rows
+// or a proportion of the remaining rows (see SizingPanel()), and may be changed while the UI runs by
+// keys bound to the GrowFocusedPanel, ShrinkFocusedPanel and ToggleMaximizedPanel actions.
 //
 // The user may use <tab> to switch between the panels.  Only the command input panel will
 // accept input.  If either of the other two panels has focus, the arrow keys may be used to
-// scroll up or down through the text output.
+// scroll up or down through the text output.  <shift>-<tab> switches between the panels in the
+// opposite direction.  In an output panel, '/' starts find mode: the query is entered in the panel
+// title (^r switches between a literal query and a regular expression), <enter> highlights the
+// matches, 'n' and 'N' move between them and <esc> ends find mode.
+//
+// If a Completer is provided via CompletingCommandsUsing(), <tab> in the command input panel completes
+// the word before the cursor rather than switching panels.  In that case, <shift>-<tab> must be used
+// to move focus out of the command input panel.
+//
+// Keys and key chords may be bound to callbacks or to built-in actions (see BindingKeyTo() and
+// BindingKeyToAction()).
 //
 // The panels may be stacked in any order desired.  The default order places the output panel
-// first, then the error output panel, then the command entry panel.
+// first, then the error output panel, then the command entry panel.  Panels may also be placed side
+// by side, using a Layout (see UsingLayout()), which may be built from LayoutOfPanel(),
+// PanelsStackedVertically() and PanelsSideBySide(), or parsed from an expression like "o|e/c" by
+// ParseLayout().
 //
 // If the user hits <esc> or <ctrl>-q, the UI exits.  This mean it Stop()s, and an additional
 // function is called.  By default, that function is os.Exit(0).  However, this may be overridden
-// via OnUIExit().
+// via OnUIExit().  The commands "quit" and "exit" also cause the UI to exit.  The exit keys and
+// commands may be changed or disabled (see ExitingOnKeys() and ExitingOnCommands()), and the user
+// may be asked to confirm before exiting (see ConfirmingExit()).
+//
+// Rather than reading only the entered commands from ChannelOfEnteredCommands(), an application may
+// read Events from ChannelOfEvents(), which also reports interrupt keys (^c by default), changes of
+// focus, terminal resizes and exits.  In that case, os.Exit(0) is not called when the UI exits.
+//
+// Run(ctx) may be used instead of Start().  It blocks until the UI exits or ctx is cancelled, returns
+// any error from initializing the terminal, and does not call os.Exit(0).  The command channel is
+// closed after the UI stops.
+//
+// The UI may also be run headless, on a tcell.SimulationScreen, by invoking UsingSimulationScreenOfSize()
+// before Start().  Key events can then be injected with SimulateKeyPress() and SimulateTypingOf(), and
+// the text drawn in each panel read back with the RenderedTextOf methods.  This allows UI behavior to be
+// exercised in a go test.
 //
 // For convenience, there is also a CommandProcessor that allows you to define patterns for possible
-// commands, and associate those will callback methods when the user enters those commands.
+// commands, and associate those will callback methods when the user enters those commands.  Commands
+// may be described either by regular expressions or by a simple declarative grammar (e.g., "read <count:int>
+// lines from <path:rest>").  Because the CommandProcessor understands grammar commands, it can supply
+// completion candidates and argument hints to the command input panel (via CompletingCommandsUsing()
+// and HintingCommandsUsing()).  Commands may also be documented, in which case the CommandProcessor can
+// provide a built-in "help" command, writing its output to any io.Writer (including a Tpcli).
 //
 // Example
 //
@@ -0,0 +1,128 @@
+package tpcli
+
+import (
+	"github.com/gdamore/tcell/v2"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+// Event types.  See Event for the fields that are meaningful for each type.
+const (
+	// CommandEntered is emitted when the user enters a command in the command panel.
+	CommandEntered EventType = iota
+
+	// InterruptKeyPressed is emitted when the user presses an interrupt key (by default, ^c).
+	InterruptKeyPressed
+
+	// FocusChanged is emitted when focus moves from one panel to another.
+	FocusChanged
+
+	// ScreenResized is emitted when the terminal changes size.
+	ScreenResized
+
+	// ExitRequested is emitted when the UI exits because the user entered an exit command or pressed an exit key
+	// (and, if ConfirmingExit was invoked, confirmed the exit).
+	ExitRequested
+)
+
+// Event is something that happened in the UI, delivered on the ChannelOfEvents.  Type determines which of the other
+// fields are meaningful.
+type Event struct {
+	Type EventType
+
+	// Command is the entered command, without the trailing newline, for CommandEntered.
+	Command string
+
+	// Key is the key that was pressed, for InterruptKeyPressed.
+	Key tcell.Key
+
+	// PanelWithFocus is the panel that received focus, for FocusChanged.
+	PanelWithFocus Panel
+
+	// Columns and Rows are the new size of the terminal, for ScreenResized.
+	Columns int
+	Rows    int
+}
+
+// TypeAsString returns the event type as a string (e.g., "command_entered"), which is useful for logging.
+func (event *Event) TypeAsString() string {
+	switch event.Type {
+	case CommandEntered:
+		return "command_entered"
+	case InterruptKeyPressed:
+		return "interrupt_key_pressed"
+	case FocusChanged:
+		return "focus_changed"
+	case ScreenResized:
+		return "screen_resized"
+	case ExitRequested:
+		return "exit_requested"
+	}
+
+	return ""
+}
+
+// ChannelOfEvents is a channel that emits an Event for each command entered, interrupt key pressed, change of focus,
+// terminal resize and exit.  Events are emitted in the order in which they occur.  Events are only emitted if this is
+// invoked before Start(), and the channel should then be read continuously, because undelivered events are retained.
+// The channel is closed after the UI stops, once the last event has been read.  When this is used, the default
+// function executed after the UI exits (which exits the process) is not executed, so the application should act on
+// the ExitRequested event instead (a function provided to OnUIExit is still executed).  Entered commands are also
+// delivered on the ChannelOfEnteredCommands, but only once it has been requested.
+func (ui *Tpcli) ChannelOfEvents() <-chan *Event {
+	if ui.eventChannel == nil {
+		ui.eventChannel = make(chan *Event)
+	}
+	return ui.eventChannel
+}
+
+// InterruptingOnKeys sets the keys which are interrupt keys.  By default, this is ^c.  When an interrupt key is
+// pressed, the text in the command panel (and any history search) is discarded, as in a shell, and an
+// InterruptKeyPressed Event is emitted.  Invoking this with no keys means that no key is an interrupt key.  In any
+// case, ^c never stops the UI, unless it is made an exit key (see ExitingOnKeys).
+func (ui *Tpcli) InterruptingOnKeys(keys ...tcell.Key) *Tpcli {
+	ui.interruptKeys = keys
+	return ui
+}
+
+func (ui *Tpcli) isAnInterruptKey(key tcell.Key) bool {
+	for _, interruptKey := range ui.interruptKeys {
+		if key == interruptKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (ui *Tpcli) interrupt(key tcell.Key) {
+	ui.commandInputPanel.discardCommand()
+	ui.emitEvent(&Event{Type: InterruptKeyPressed, Key: key})
+}
+
+// emitEvent queues event for delivery on the ChannelOfEvents, if that is used.  It does not wait for the event to be
+// read, so it may be invoked from the UI goroutine.
+func (ui *Tpcli) emitEvent(event *Event) {
+	if ui.eventsToDeliver != nil {
+		ui.eventsToDeliver.Add(event)
+	}
+}
+
+func (ui *Tpcli) relayEventsToChannelOfEvents() {
+	for event := range ui.eventsToDeliver.out {
+		ui.eventChannel <- event.(*Event)
+	}
+	close(ui.eventChannel)
+}
+
+// emitEventIfScreenWasResized is invoked before each draw, and emits a ScreenResized Event if the screen size has
+// changed since the previous draw.
+func (ui *Tpcli) emitEventIfScreenWasResized(screen tcell.Screen) {
+	columns, rows := screen.Size()
+
+	if ui.lastDrawnScreenColumns != 0 && (columns != ui.lastDrawnScreenColumns || rows != ui.lastDrawnScreenRows) {
+		ui.emitEvent(&Event{Type: ScreenResized, Columns: columns, Rows: rows})
+	}
+
+	ui.lastDrawnScreenColumns, ui.lastDrawnScreenRows = columns, rows
+}
@@ -0,0 +1,106 @@
+package tpcli
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const exitConfirmationPageName = "exitConfirmation"
+
+// ExitingOnCommands sets the commands which, when entered in the command panel, cause the UI to exit.  By default,
+// these are "quit" and "exit".  Invoking this with no commands means that no command causes an exit, so that the
+// application may use those words for its own commands.  A command that causes an exit is still delivered on the
+// ChannelOfEnteredCommands.
+func (ui *Tpcli) ExitingOnCommands(commands ...string) *Tpcli {
+	ui.exitCommands = commands
+	return ui
+}
+
+// ExitingOnKeys sets the keys which cause the UI to exit.  By default, these are <esc> and ^q.  Invoking this with no
+// keys means that no key causes an exit.  When the command panel is searching the command history or is using vi
+// editing mode, <esc> is used by the command panel rather than causing an exit.
+func (ui *Tpcli) ExitingOnKeys(keys ...tcell.Key) *Tpcli {
+	ui.exitKeys = keys
+	return ui
+}
+
+// ConfirmingExit instructs the Tpcli to ask "Really quit?" before exiting when an exit command is entered or an exit
+// key is pressed.  The user may answer with the buttons, or with 'y' or 'n'.  <esc> also answers no.  The function
+// provided to OnUIExit is executed only if the user answers yes.
+func (ui *Tpcli) ConfirmingExit() *Tpcli {
+	ui.confirmBeforeExiting = true
+	return ui
+}
+
+func (ui *Tpcli) isAnExitCommand(command string) bool {
+	for _, exitCommand := range ui.exitCommands {
+		if command == exitCommand {
+			return true
+		}
+	}
+	return false
+}
+
+func (ui *Tpcli) isAnExitKey(key tcell.Key) bool {
+	for _, exitKey := range ui.exitKeys {
+		if key == exitKey {
+			return true
+		}
+	}
+	return false
+}
+
+// requestExit exits, or if ConfirmingExit was invoked, asks the user to confirm the exit.
+func (ui *Tpcli) requestExit() {
+	if ui.confirmBeforeExiting {
+		ui.showExitConfirmation()
+	} else {
+		ui.exit()
+	}
+}
+
+func (ui *Tpcli) exitConfirmationIsShown() bool {
+	return ui.uiPages != nil && ui.uiPages.HasPage(exitConfirmationPageName)
+}
+
+func (ui *Tpcli) showExitConfirmation() {
+	if ui.exitConfirmationIsShown() {
+		return
+	}
+
+	modal := tview.NewModal().
+		SetText("Really quit?").
+		AddButtons([]string{"Yes", "No"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.answerExitConfirmation(buttonLabel == "Yes")
+		})
+
+	ui.applyThemeToModal(modal)
+
+	modal.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune {
+			switch event.Rune() {
+			case 'y', 'Y':
+				ui.answerExitConfirmation(true)
+				return nil
+			case 'n', 'N':
+				ui.answerExitConfirmation(false)
+				return nil
+			}
+		}
+		return event
+	})
+
+	ui.uiPages.AddPage(exitConfirmationPageName, modal, false, true)
+	ui.tviewApplication.SetFocus(modal)
+}
+
+func (ui *Tpcli) answerExitConfirmation(userReallyWantsToExit bool) {
+	ui.uiPages.RemovePage(exitConfirmationPageName)
+
+	if userReallyWantsToExit {
+		ui.exit()
+	} else {
+		ui.focusPanelWithFocusIndex()
+	}
+}
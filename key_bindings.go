@@ -0,0 +1,259 @@
+package tpcli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// KeyAction is the name of a built-in action which may be bound to a key using BindingKeyToAction.
+type KeyAction string
+
+const (
+	// FocusNextPanel moves focus to the next panel, as <tab> does.
+	FocusNextPanel KeyAction = "focus-next-panel"
+
+	// FocusPreviousPanel moves focus to the previous panel.
+	FocusPreviousPanel KeyAction = "focus-previous-panel"
+
+	// ClearGeneralOutput removes all text from the general output panel.
+	ClearGeneralOutput KeyAction = "clear-general-output"
+
+	// ClearErrorOutput removes all text from the error (or command history) panel.
+	ClearErrorOutput KeyAction = "clear-error-output"
+
+	// ScrollToBottom scrolls the general output and error panels so that their most recent text is shown.
+	ScrollToBottom KeyAction = "scroll-to-bottom"
+
+	// SubmitCommand delivers the text in the command panel, as <enter> does, but even if multi-line input is
+	// used and the command is not complete.
+	SubmitCommand KeyAction = "submit-command"
+
+	// FindInOutput starts find mode in the output panel that has focus, as '/' does.  It does nothing if the command
+	// panel has focus.
+	FindInOutput KeyAction = "find-in-output"
+
+	// GrowFocusedPanel makes the panel with focus one row taller (see SizingPanel).
+	GrowFocusedPanel KeyAction = "grow-panel"
+
+	// ShrinkFocusedPanel makes the panel with focus one row shorter.
+	ShrinkFocusedPanel KeyAction = "shrink-panel"
+
+	// ToggleMaximizedPanel shows only the output panel with focus (or the general output panel, if the command panel
+	// has focus) and the command panel, or shows every panel again if a panel is already maximized.
+	ToggleMaximizedPanel KeyAction = "maximize-panel"
+
+	// Exit exits the UI, as an exit key does (including asking for confirmation if ConfirmingExit was invoked).
+	Exit KeyAction = "exit"
+)
+
+// keyStroke is a single key press, independent of modifiers other than <alt>.
+type keyStroke struct {
+	key tcell.Key
+	r   rune // only meaningful when key is tcell.KeyRune
+	alt bool
+}
+
+func keyStrokeOf(event *tcell.EventKey) keyStroke {
+	stroke := keyStroke{key: event.Key(), alt: event.Modifiers()&tcell.ModAlt != 0}
+	if stroke.key == tcell.KeyRune {
+		stroke.r = event.Rune()
+	}
+	return stroke
+}
+
+type keyBinding struct {
+	strokes  []keyStroke
+	callback func()
+}
+
+var keysByLowercaseName = func() map[string]tcell.Key {
+	keys := map[string]tcell.Key{
+		"escape":    tcell.KeyEscape,
+		"shift-tab": tcell.KeyBacktab,
+		"return":    tcell.KeyEnter,
+	}
+	for key, name := range tcell.KeyNames {
+		if key != tcell.KeyRune {
+			keys[strings.ToLower(name)] = key
+		}
+	}
+	return keys
+}()
+
+// parseKeySpec converts a key specification (see BindingKeyTo) into the sequence of key strokes that it describes.
+func parseKeySpec(keySpec string) ([]keyStroke, error) {
+	keyNames := strings.Fields(keySpec)
+	if len(keyNames) == 0 {
+		return nil, fmt.Errorf("key specification is empty")
+	}
+
+	strokes := make([]keyStroke, 0, len(keyNames))
+	for _, keyName := range keyNames {
+		stroke, err := parseSingleKey(keyName)
+		if err != nil {
+			return nil, err
+		}
+		strokes = append(strokes, stroke)
+	}
+
+	return strokes, nil
+}
+
+func parseSingleKey(keyName string) (keyStroke, error) {
+	stroke := keyStroke{}
+
+	nameWithoutModifier := keyName
+	if len(keyName) > len("alt-") && strings.EqualFold(keyName[:len("alt-")], "alt-") {
+		stroke.alt = true
+		nameWithoutModifier = keyName[len("alt-"):]
+	}
+
+	if runes := []rune(nameWithoutModifier); len(runes) == 1 {
+		stroke.key = tcell.KeyRune
+		stroke.r = runes[0]
+		return stroke, nil
+	}
+
+	lowercaseName := strings.ToLower(nameWithoutModifier)
+
+	if lowercaseName == "space" {
+		stroke.key = tcell.KeyRune
+		stroke.r = ' '
+		return stroke, nil
+	}
+
+	if key, isKnown := keysByLowercaseName[lowercaseName]; isKnown {
+		stroke.key = key
+		return stroke, nil
+	}
+
+	// Ctrl-H, Ctrl-I and Ctrl-M have no names of their own, because they are the same as Backspace, Tab and Enter
+	if len(lowercaseName) == len("ctrl-a") && strings.HasPrefix(lowercaseName, "ctrl-") && lowercaseName[5] >= 'a' && lowercaseName[5] <= 'z' {
+		stroke.key = tcell.KeyCtrlA + tcell.Key(lowercaseName[5]-'a')
+		return stroke, nil
+	}
+
+	return stroke, fmt.Errorf("(%s) is not a known key", keyName)
+}
+
+// ValidateKeyBinding returns an error if keySpec is not a valid key specification (see BindingKeyTo), or if action is
+// not the name of a built-in KeyAction.  It is useful for checking bindings read from a configuration file before they
+// are provided to BindingKeyToAction (which panics if they are invalid).
+func ValidateKeyBinding(keySpec string, action string) error {
+	if _, err := parseKeySpec(keySpec); err != nil {
+		return err
+	}
+
+	switch KeyAction(action) {
+	case FocusNextPanel, FocusPreviousPanel, ClearGeneralOutput, ClearErrorOutput, ScrollToBottom, SubmitCommand, FindInOutput,
+		GrowFocusedPanel, ShrinkFocusedPanel, ToggleMaximizedPanel, Exit:
+		return nil
+	default:
+		return fmt.Errorf("(%s) is not a known key action", action)
+	}
+}
+
+// BindingKeyTo arranges for callback to be executed when the keys described by keySpec are pressed.  keySpec is one
+// or more keys separated by spaces (e.g., "Ctrl-X Ctrl-S"), so that a binding may be a chord of more than one key.
+// Each key is either a single character (e.g., "q"), "Space", or a key name used by tcell (e.g., "Ctrl-L", "F5",
+// "PgUp", "Esc", "Enter", "Backtab"), and may be preceded by "Alt-".  Key names are not case-sensitive.  Bindings
+// take precedence over the built-in keys (including those of the command panel), regardless of which panel has focus.
+// The callback is executed in the UI goroutine.  If keySpec is invalid, this method panics.  This must be invoked
+// before Start().
+func (ui *Tpcli) BindingKeyTo(keySpec string, callback func()) *Tpcli {
+	strokes, err := parseKeySpec(keySpec)
+	if err != nil {
+		panic(fmt.Sprintf("BindingKeyTo invoked with an invalid key specification: %s", err.Error()))
+	}
+
+	ui.keyBindings = append(ui.keyBindings, &keyBinding{strokes: strokes, callback: callback})
+	return ui
+}
+
+// BindingKeyToAction is the same as BindingKeyTo, but the keys are bound to a built-in action rather than to a
+// callback.  If keySpec or action is invalid, this method panics.
+func (ui *Tpcli) BindingKeyToAction(keySpec string, action KeyAction) *Tpcli {
+	if err := ValidateKeyBinding(keySpec, string(action)); err != nil {
+		panic(fmt.Sprintf("BindingKeyToAction invoked with an invalid binding: %s", err.Error()))
+	}
+
+	return ui.BindingKeyTo(keySpec, func() { ui.performKeyAction(action) })
+}
+
+func (ui *Tpcli) performKeyAction(action KeyAction) {
+	switch action {
+	case FocusNextPanel:
+		ui.moveFocusToNextPanel()
+	case FocusPreviousPanel:
+		ui.moveFocusToPreviousPanel()
+	case ClearGeneralOutput:
+		ui.addPendingOutputToPanels()
+		ui.generalOutputPanel.Clear()
+	case ClearErrorOutput:
+		ui.addPendingOutputToPanels()
+		ui.errorOrHistoryPanel.Clear()
+	case ScrollToBottom:
+		ui.generalOutputPanel.ScrollToEnd()
+		ui.errorOrHistoryPanel.ScrollToEnd()
+	case SubmitCommand:
+		ui.commandInputPanel.submitCommand()
+	case FindInOutput:
+		if focusedOutputPanel := ui.focusedOutputPanel(); focusedOutputPanel != nil {
+			focusedOutputPanel.BeginFind()
+		}
+	case GrowFocusedPanel:
+		ui.resizeFocusedPanelBy(1)
+	case ShrinkFocusedPanel:
+		ui.resizeFocusedPanelBy(-1)
+	case ToggleMaximizedPanel:
+		ui.toggleMaximizedPanel()
+	case Exit:
+		ui.requestExit()
+	}
+}
+
+// dispatchKeyBindings matches a key event against the bindings, returning true if the event was consumed, either
+// because it completed a binding (whose callback is then executed) or because it is part of a chord that may yet
+// complete a binding.  If a partially entered chord cannot be completed, the keys already entered are discarded.
+func (ui *Tpcli) dispatchKeyBindings(event *tcell.EventKey) bool {
+	if len(ui.keyBindings) == 0 {
+		return false
+	}
+
+	strokesSoFar := append(ui.pendingChordStrokes, keyStrokeOf(event))
+	ui.pendingChordStrokes = nil
+
+	for _, binding := range ui.keyBindings {
+		if len(binding.strokes) == len(strokesSoFar) && keyStrokesStartWith(binding.strokes, strokesSoFar) {
+			binding.callback()
+			return true
+		}
+	}
+
+	for _, binding := range ui.keyBindings {
+		if keyStrokesStartWith(binding.strokes, strokesSoFar) {
+			ui.pendingChordStrokes = strokesSoFar
+			return true
+		}
+	}
+
+	if len(strokesSoFar) > 1 {
+		return ui.dispatchKeyBindings(event)
+	}
+
+	return false
+}
+
+func keyStrokesStartWith(strokes []keyStroke, prefix []keyStroke) bool {
+	if len(prefix) > len(strokes) {
+		return false
+	}
+	for i := range prefix {
+		if strokes[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
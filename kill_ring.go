@@ -0,0 +1,73 @@
+package tpcli
+
+// killRing holds text removed from the command input panel by the kill commands (^k, ^u and ^w), so that it may
+// be yanked (^y) back into the line, as with readline.  Consecutive kills are accumulated into a single entry.  After
+// a yank, the yanked text may be replaced by successively older entries (M-y), cycling back to the most recent entry
+// after the oldest.
+type killRing struct {
+	entries            []string // most recent last
+	maximumEntries     int
+	indexOfYankedEntry int
+}
+
+func newKillRing(maximumEntries int) *killRing {
+	return &killRing{
+		entries:        make([]string, 0, maximumEntries),
+		maximumEntries: maximumEntries,
+	}
+}
+
+// Push adds text as the most recent entry, discarding the oldest entry if the ring is full.
+func (ring *killRing) Push(text string) {
+	if len(ring.entries) == ring.maximumEntries {
+		ring.entries = ring.entries[1:]
+	}
+	ring.entries = append(ring.entries, text)
+}
+
+// AppendToMostRecent adds text to the end of the most recent entry (for a kill that follows a kill of text before
+// it).  If the ring is empty, text becomes the most recent entry.
+func (ring *killRing) AppendToMostRecent(text string) {
+	if len(ring.entries) == 0 {
+		ring.Push(text)
+		return
+	}
+	ring.entries[len(ring.entries)-1] += text
+}
+
+// PrependToMostRecent adds text to the start of the most recent entry (for a kill that follows a kill of text after
+// it).  If the ring is empty, text becomes the most recent entry.
+func (ring *killRing) PrependToMostRecent(text string) {
+	if len(ring.entries) == 0 {
+		ring.Push(text)
+		return
+	}
+	ring.entries[len(ring.entries)-1] = text + ring.entries[len(ring.entries)-1]
+}
+
+// Yank returns the most recent entry.  ok is false if the ring is empty.
+func (ring *killRing) Yank() (text string, ok bool) {
+	if len(ring.entries) == 0 {
+		return "", false
+	}
+	ring.indexOfYankedEntry = len(ring.entries) - 1
+	return ring.entries[ring.indexOfYankedEntry], true
+}
+
+// CurrentlyYanked returns the entry most recently returned by Yank or RotateAndYank.
+func (ring *killRing) CurrentlyYanked() string {
+	return ring.entries[ring.indexOfYankedEntry]
+}
+
+// RotateAndYank returns the entry older than the one most recently returned by Yank or RotateAndYank, wrapping to
+// the most recent entry after the oldest.  ok is false if the ring is empty.
+func (ring *killRing) RotateAndYank() (text string, ok bool) {
+	if len(ring.entries) == 0 {
+		return "", false
+	}
+	ring.indexOfYankedEntry--
+	if ring.indexOfYankedEntry < 0 {
+		ring.indexOfYankedEntry = len(ring.entries) - 1
+	}
+	return ring.entries[ring.indexOfYankedEntry], true
+}
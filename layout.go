@@ -0,0 +1,512 @@
+package tpcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Layout describes how the three panels are arranged on the screen.  A Layout is a single panel (see
+// LayoutOfPanel), a stack of layouts from top to bottom (see PanelsStackedVertically) or layouts side by side from
+// left to right (see PanelsSideBySide).  These may be nested so that, for example, the general output and error
+// panels are side by side above the command panel:
+//
+//	tpcli.PanelsStackedVertically(
+//	    tpcli.PanelsSideBySide(tpcli.LayoutOfPanel(tpcli.GeneralOutputPanel), tpcli.LayoutOfPanel(tpcli.ErrorOrHistoryPanel)),
+//	    tpcli.LayoutOfPanel(tpcli.CommandPanel))
+//
+// A Layout may also be parsed from an expression (see ParseLayout).  A Layout is provided to UsingLayout, and must
+// include each panel exactly once.
+type Layout struct {
+	arrangement layoutArrangement
+	panel       Panel     // if the arrangement is singlePanel
+	elements    []*Layout // otherwise
+	widthWeight uint      // 0 unless set by WithWidthWeight
+}
+
+type layoutArrangement int
+
+const (
+	singlePanel layoutArrangement = iota
+	stackedVertically
+	sideBySide
+)
+
+// LayoutOfPanel returns the layout of a single panel.
+func LayoutOfPanel(panel Panel) *Layout {
+	return &Layout{arrangement: singlePanel, panel: panel}
+}
+
+// PanelsStackedVertically returns a layout in which the elements are stacked from top to bottom, each using all of
+// the columns of the layout.  The height of each element is the height of its panel (see SizingPanel).  The height of
+// an element that is itself a stack is the sum of the heights of its elements, and the height of an element that
+// has panels side by side is the greatest of the heights of its elements.  In either case, the element's height is
+// proportional if the height of any of its elements is.
+func PanelsStackedVertically(elements ...*Layout) *Layout {
+	return &Layout{arrangement: stackedVertically, elements: elements}
+}
+
+// PanelsSideBySide returns a layout in which the elements are side by side from left to right, each using all of the
+// rows of the layout.  The columns are shared among the elements in proportion to their width weights (see
+// WithWidthWeight), which are 1 by default, so that by default the elements have the same width.
+func PanelsSideBySide(elements ...*Layout) *Layout {
+	return &Layout{arrangement: sideBySide, elements: elements}
+}
+
+// WithWidthWeight sets the share of the columns that the layout receives when it is an element of PanelsSideBySide
+// (at least 1).  For example, if one element has a weight of 2 and the other has a weight of 1, the first receives
+// two thirds of the columns.  The weight is ignored in other layouts.
+func (layout *Layout) WithWidthWeight(weight uint) *Layout {
+	if weight == 0 {
+		weight = 1
+	}
+	layout.widthWeight = weight
+	return layout
+}
+
+func (layout *Layout) widthProportion() int {
+	if layout.widthWeight == 0 {
+		return 1
+	}
+	return int(layout.widthWeight)
+}
+
+// ParseLayout returns the layout described by an expression, in which 'o' is the general output panel, 'e' (or 'h')
+// is the error (or command history) panel and 'c' is the command panel.  Layouts separated by '/' are stacked from
+// top to bottom, and layouts separated by '|' are side by side from left to right.  '|' binds more tightly than '/',
+// and parentheses group layouts.  An element of layouts that are side by side may be preceded by <weight>* to set
+// its width weight (see WithWidthWeight).  Spaces are ignored.  For example:
+//
+//	o/e/c         the general output, error and command panels stacked, as by default
+//	o|e/c         the general output and error panels side by side, above the command panel
+//	2*o|(e/c)     the general output panel to the left of the error panel, which is above the command panel, with
+//	              the general output panel taking two thirds of the columns
+//
+// Each panel must appear exactly once.  If the expression is not a layout, an error is returned.
+func ParseLayout(expression string) (*Layout, error) {
+	parser := &layoutParser{expression: expression}
+
+	layout, err := parser.parseStack()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.peek() != 0 {
+		return nil, parser.problem("(%c) is unexpected", parser.peek())
+	}
+
+	if err := layout.validate(); err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// AsString returns the layout as an expression that ParseLayout accepts (e.g., "o|e/c").
+func (layout *Layout) AsString() string {
+	switch layout.arrangement {
+	case singlePanel:
+		switch layout.panel {
+		case GeneralOutputPanel:
+			return "o"
+		case ErrorOrHistoryPanel:
+			return "e"
+		default:
+			return "c"
+		}
+
+	case stackedVertically:
+		elements := make([]string, len(layout.elements))
+		for i, element := range layout.elements {
+			elements[i] = element.AsString()
+			if element.arrangement == stackedVertically {
+				elements[i] = "(" + elements[i] + ")"
+			}
+		}
+		return strings.Join(elements, "/")
+
+	default:
+		elements := make([]string, len(layout.elements))
+		for i, element := range layout.elements {
+			elements[i] = element.AsString()
+			if element.arrangement != singlePanel {
+				elements[i] = "(" + elements[i] + ")"
+			}
+			if element.widthWeight != 0 {
+				elements[i] = fmt.Sprintf("%d*%s", element.widthWeight, elements[i])
+			}
+		}
+		return strings.Join(elements, "|")
+	}
+}
+
+// validate returns an error unless the layout includes each panel exactly once, and each stack or set of panels side
+// by side has at least one element.
+func (layout *Layout) validate() error {
+	timesPanelAppears := map[Panel]int{GeneralOutputPanel: 0, ErrorOrHistoryPanel: 0, CommandPanel: 0}
+
+	var countPanelsIn func(layout *Layout) error
+	countPanelsIn = func(layout *Layout) error {
+		if layout.arrangement == singlePanel {
+			if _, isAPanel := timesPanelAppears[layout.panel]; !isAPanel {
+				return fmt.Errorf("a layout includes an unknown panel (%d)", layout.panel)
+			}
+			timesPanelAppears[layout.panel]++
+			return nil
+		}
+
+		if len(layout.elements) == 0 {
+			return fmt.Errorf("a layout of panels stacked or side by side must have at least one element")
+		}
+
+		for _, element := range layout.elements {
+			if err := countPanelsIn(element); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := countPanelsIn(layout); err != nil {
+		return err
+	}
+
+	for _, timesAppeared := range timesPanelAppears {
+		if timesAppeared != 1 {
+			return fmt.Errorf("a layout must include each panel exactly once")
+		}
+	}
+
+	return nil
+}
+
+// panelsInReadingOrder returns the panels of the layout from top to bottom and, where they are side by side, from
+// left to right.  This is the order in which focus moves between them.
+func (layout *Layout) panelsInReadingOrder() []Panel {
+	if layout.arrangement == singlePanel {
+		return []Panel{layout.panel}
+	}
+
+	var panels []Panel
+	for _, element := range layout.elements {
+		panels = append(panels, element.panelsInReadingOrder()...)
+	}
+
+	return panels
+}
+
+func (layout *Layout) includes(panel Panel) bool {
+	for _, panelInLayout := range layout.panelsInReadingOrder() {
+		if panelInLayout == panel {
+			return true
+		}
+	}
+	return false
+}
+
+// arrangementSeparating returns the arrangement of the smallest part of the layout that includes both panels.
+func (layout *Layout) arrangementSeparating(panel Panel, otherPanel Panel) layoutArrangement {
+	return layout.partSeparating(panel, otherPanel).arrangement
+}
+
+// partSeparating returns the smallest part of the layout that includes both panels.
+func (layout *Layout) partSeparating(panel Panel, otherPanel Panel) *Layout {
+	for _, element := range layout.elements {
+		if element.includes(panel) && element.includes(otherPanel) {
+			return element.partSeparating(panel, otherPanel)
+		}
+	}
+	return layout
+}
+
+// elementIncluding returns the element of the layout that includes panel, or nil if none does.
+func (layout *Layout) elementIncluding(panel Panel) *Layout {
+	for _, element := range layout.elements {
+		if element.includes(panel) {
+			return element
+		}
+	}
+	return nil
+}
+
+type layoutParser struct {
+	expression string
+	position   int
+}
+
+// peek returns the next character of the expression that is not a space, or 0 at the end of the expression.
+func (parser *layoutParser) peek() byte {
+	for parser.position < len(parser.expression) && parser.expression[parser.position] == ' ' {
+		parser.position++
+	}
+
+	if parser.position == len(parser.expression) {
+		return 0
+	}
+	return parser.expression[parser.position]
+}
+
+func (parser *layoutParser) consume(c byte) bool {
+	if parser.peek() == c {
+		parser.position++
+		return true
+	}
+	return false
+}
+
+func (parser *layoutParser) problem(format string, a ...interface{}) error {
+	return fmt.Errorf("in layout (%s) at position %d, %s", parser.expression, parser.position+1, fmt.Sprintf(format, a...))
+}
+
+func (parser *layoutParser) parseStack() (*Layout, error) {
+	var elements []*Layout
+
+	for {
+		element, err := parser.parseSideBySide()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		if !parser.consume('/') {
+			break
+		}
+	}
+
+	if len(elements) == 1 {
+		return elements[0], nil
+	}
+	return PanelsStackedVertically(elements...), nil
+}
+
+func (parser *layoutParser) parseSideBySide() (*Layout, error) {
+	var elements []*Layout
+	startOfElements := parser.position
+
+	for {
+		element, err := parser.parseElement()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		if !parser.consume('|') {
+			break
+		}
+	}
+
+	if len(elements) == 1 {
+		if elements[0].widthWeight != 0 {
+			parser.position = startOfElements
+			return nil, parser.problem("a width weight is allowed only for layouts side by side")
+		}
+		return elements[0], nil
+	}
+	return PanelsSideBySide(elements...), nil
+}
+
+func (parser *layoutParser) parseElement() (*Layout, error) {
+	var weight uint64
+
+	if isADigit(parser.peek()) {
+		startOfWeight := parser.position
+		for parser.position < len(parser.expression) && isADigit(parser.expression[parser.position]) {
+			parser.position++
+		}
+
+		var err error
+		if weight, err = strconv.ParseUint(parser.expression[startOfWeight:parser.position], 10, 32); err != nil || weight == 0 {
+			parser.position = startOfWeight
+			return nil, parser.problem("a width weight must be a positive integer")
+		}
+
+		if !parser.consume('*') {
+			return nil, parser.problem("a width weight must be followed by '*'")
+		}
+	}
+
+	var layout *Layout
+
+	switch c := parser.peek(); c {
+	case 'o':
+		layout = LayoutOfPanel(GeneralOutputPanel)
+	case 'e', 'h':
+		layout = LayoutOfPanel(ErrorOrHistoryPanel)
+	case 'c':
+		layout = LayoutOfPanel(CommandPanel)
+	case '(':
+		parser.position++
+		var err error
+		if layout, err = parser.parseStack(); err != nil {
+			return nil, err
+		}
+		if parser.peek() != ')' {
+			return nil, parser.problem("')' is expected")
+		}
+	case 0:
+		return nil, parser.problem("the layout ends where a panel letter (o, e, h or c) or '(' is expected")
+	default:
+		return nil, parser.problem("(%c) is not a panel letter (o, e, h or c) or '('", c)
+	}
+	parser.position++
+
+	if weight > 0 {
+		layout.WithWidthWeight(uint(weight))
+	}
+
+	return layout, nil
+}
+
+func isADigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// UsingLayout arranges the panels as described by layout (by default, the general output, error and command panels
+// are stacked from top to bottom).  Focus moves between the panels in reading order: from top to bottom and, where
+// they are side by side, from left to right.  If the layout does not include each panel exactly once, this method
+// panics.  This must be invoked before Start().
+func (ui *Tpcli) UsingLayout(layout *Layout) *Tpcli {
+	if err := layout.validate(); err != nil {
+		panic(fmt.Sprintf("UsingLayout invoked with an invalid layout: %s", err.Error()))
+	}
+
+	ui.layout = layout
+	ui.panelTypesInOrder = nil
+	for i, panel := range layout.panelsInReadingOrder() {
+		ui.panelTypesInOrder = append(ui.panelTypesInOrder, typeOfPanel(panel))
+		if panel == CommandPanel {
+			ui.indexInOrderOfPanelWithFocus = i
+		}
+	}
+
+	return ui
+}
+
+// composeIntoLayout arranges the panels as described by the layout, in a page so that the exit confirmation (or a
+// maximized panel) can be shown in place of them.
+func (ui *Tpcli) composeIntoLayout() *Tpcli {
+	ui.layoutFlexes = make(map[*Layout]*tview.Flex)
+	panels := ui.tviewPrimitiveFor(ui.layout)
+	ui.layOutPanels()
+
+	ui.uiPages = tview.NewPages().AddPage(panelsPageName, panels, true, true)
+	ui.tviewApplication.SetRoot(ui.uiPages, true)
+
+	return ui
+}
+
+// tviewPrimitiveFor returns the tview primitive that shows layout: the backing object of a single panel, or else a
+// tview.Flex (created when it is first needed) of the primitives for the layout's elements.
+func (ui *Tpcli) tviewPrimitiveFor(layout *Layout) tview.Primitive {
+	if layout.arrangement == singlePanel {
+		switch layout.panel {
+		case CommandPanel:
+			return ui.commandInputPanel.BackingTviewObject()
+		case GeneralOutputPanel:
+			return ui.generalOutputPanel.BackingTviewObject()
+		default:
+			return ui.errorOrHistoryPanel.BackingTviewObject()
+		}
+	}
+
+	if flex, flexIsCreated := ui.layoutFlexes[layout]; flexIsCreated {
+		return flex
+	}
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow)
+	if layout.arrangement == sideBySide {
+		flex.SetDirection(tview.FlexColumn)
+	}
+
+	for _, element := range layout.elements {
+		flex.AddItem(ui.tviewPrimitiveFor(element), 0, 1, element.includes(CommandPanel))
+	}
+
+	ui.layoutFlexes[layout] = flex
+	return flex
+}
+
+// sizeElementsOf applies the heights of the panels (or, for panels side by side, the width weights) to the elements
+// of layout, and to the elements of each of its elements.
+func (ui *Tpcli) sizeElementsOf(layout *Layout) {
+	if layout.arrangement == singlePanel {
+		return
+	}
+
+	flex := ui.layoutFlexes[layout]
+	for _, element := range layout.elements {
+		fixedSize, proportion := 0, element.widthProportion()
+		if layout.arrangement == stackedVertically {
+			if height := ui.heightOf(element); height.IsProportional() {
+				proportion = int(height.proportion)
+			} else {
+				fixedSize, proportion = int(height.rows), 0
+			}
+		}
+
+		flex.ResizeItem(ui.tviewPrimitiveFor(element), fixedSize, proportion)
+		ui.sizeElementsOf(element)
+	}
+}
+
+// heightOf returns the height of layout as an element of a stack (see PanelsStackedVertically).
+func (ui *Tpcli) heightOf(layout *Layout) PanelSize {
+	if layout.arrangement == singlePanel {
+		if layout.panel == CommandPanel {
+			return FixedRows(uint(ui.commandPanelRows()))
+		}
+		return ui.panelSizes[layout.panel]
+	}
+
+	var rows, proportion uint
+	for _, element := range layout.elements {
+		height := ui.heightOf(element)
+
+		if layout.arrangement == stackedVertically {
+			rows += height.rows
+			proportion += height.proportion
+		} else {
+			if height.rows > rows {
+				rows = height.rows
+			}
+			if height.proportion > proportion {
+				proportion = height.proportion
+			}
+		}
+	}
+
+	if proportion > 0 {
+		return ProportionOfRemainingRows(proportion)
+	}
+	return FixedRows(rows)
+}
+
+// minimumRowsOf returns the rows needed by layout when the panels with proportional sizes are at their minimum
+// height.
+func (ui *Tpcli) minimumRowsOf(layout *Layout) int {
+	if layout.arrangement == singlePanel {
+		if layout.panel == CommandPanel {
+			return ui.commandPanelRows()
+		}
+		if size := ui.panelSizes[layout.panel]; !size.IsProportional() {
+			return int(size.rows)
+		}
+		return minimumOutputPanelRows
+	}
+
+	rows := 0
+	for _, element := range layout.elements {
+		elementRows := ui.minimumRowsOf(element)
+
+		if layout.arrangement == stackedVertically {
+			rows += elementRows
+		} else if elementRows > rows {
+			rows = elementRows
+		}
+	}
+
+	return rows
+}
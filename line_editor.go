@@ -0,0 +1,239 @@
+package tpcli
+
+import (
+	"unicode"
+)
+
+// lineEditor holds the text of a command as it is being edited, along with the position of the cursor
+// within that text.  The cursor is a rune index, and may range from 0 (before the first rune) to the
+// number of runes in the text (after the last rune).  Words are runs of non-whitespace runes.  The text
+// may contain newlines, in which case it is made up of more than one line.
+type lineEditor struct {
+	text   []rune
+	cursor int
+}
+
+func newLineEditor() *lineEditor {
+	return &lineEditor{
+		text:   []rune{},
+		cursor: 0,
+	}
+}
+
+func (editor *lineEditor) Text() string {
+	return string(editor.text)
+}
+
+// CursorByteOffset returns the cursor position as a byte offset into the string returned by Text().
+func (editor *lineEditor) CursorByteOffset() int {
+	return len(string(editor.text[:editor.cursor]))
+}
+
+func (editor *lineEditor) SetText(newText string) {
+	editor.text = []rune(newText)
+	editor.cursor = len(editor.text)
+}
+
+func (editor *lineEditor) Insert(s string) {
+	inserted := []rune(s)
+
+	newText := make([]rune, 0, len(editor.text)+len(inserted))
+	newText = append(newText, editor.text[:editor.cursor]...)
+	newText = append(newText, inserted...)
+	newText = append(newText, editor.text[editor.cursor:]...)
+
+	editor.text = newText
+	editor.cursor += len(inserted)
+}
+
+// ReplaceBetween replaces the runes from index start up to (but excluding) index end with replacement,
+// leaving the cursor at the end of the replacement.
+func (editor *lineEditor) ReplaceBetween(start int, end int, replacement string) {
+	editor.cursor = start
+	editor.deleteBetween(start, end)
+	editor.Insert(replacement)
+}
+
+func (editor *lineEditor) MoveToStart() {
+	editor.cursor = 0
+}
+
+func (editor *lineEditor) MoveToEnd() {
+	editor.cursor = len(editor.text)
+}
+
+func (editor *lineEditor) MoveToStartOfLine() {
+	editor.cursor, _ = editor.boundsOfLineContaining(editor.cursor)
+}
+
+func (editor *lineEditor) MoveToEndOfLine() {
+	_, editor.cursor = editor.boundsOfLineContaining(editor.cursor)
+}
+
+// MoveUpALine moves the cursor to the same column (or the end, if it is shorter) of the line before the
+// line containing the cursor.  It returns false, and does not move the cursor, if the cursor is on the
+// first line.
+func (editor *lineEditor) MoveUpALine() bool {
+	start, _ := editor.boundsOfLineContaining(editor.cursor)
+	if start == 0 {
+		return false
+	}
+
+	previousStart, previousEnd := editor.boundsOfLineContaining(start - 1)
+	editor.cursor = minimumOf(previousStart+editor.cursor-start, previousEnd)
+	return true
+}
+
+// MoveDownALine moves the cursor to the same column (or the end, if it is shorter) of the line after the
+// line containing the cursor.  It returns false, and does not move the cursor, if the cursor is on the
+// last line.
+func (editor *lineEditor) MoveDownALine() bool {
+	start, end := editor.boundsOfLineContaining(editor.cursor)
+	if end == len(editor.text) {
+		return false
+	}
+
+	nextStart, nextEnd := editor.boundsOfLineContaining(end + 1)
+	editor.cursor = minimumOf(nextStart+editor.cursor-start, nextEnd)
+	return true
+}
+
+// Lines returns the text split into lines, along with the index of the line containing the cursor and
+// the rune offset of the cursor within that line.
+func (editor *lineEditor) Lines() (lines [][]rune, cursorLine int, cursorColumn int) {
+	lineStart := 0
+	for i, r := range editor.text {
+		if r == '\n' {
+			lines = append(lines, editor.text[lineStart:i])
+			lineStart = i + 1
+		}
+	}
+	lines = append(lines, editor.text[lineStart:])
+
+	start, _ := editor.boundsOfLineContaining(editor.cursor)
+	for _, r := range editor.text[:start] {
+		if r == '\n' {
+			cursorLine++
+		}
+	}
+
+	return lines, cursorLine, editor.cursor - start
+}
+
+func (editor *lineEditor) MoveLeft() {
+	if editor.cursor > 0 {
+		editor.cursor--
+	}
+}
+
+func (editor *lineEditor) MoveRight() {
+	if editor.cursor < len(editor.text) {
+		editor.cursor++
+	}
+}
+
+func (editor *lineEditor) MoveWordLeft() {
+	editor.cursor = editor.startOfWordBeforeCursor()
+}
+
+func (editor *lineEditor) MoveWordRight() {
+	position := editor.cursor
+	for position < len(editor.text) && unicode.IsSpace(editor.text[position]) {
+		position++
+	}
+	for position < len(editor.text) && !unicode.IsSpace(editor.text[position]) {
+		position++
+	}
+	editor.cursor = position
+}
+
+func (editor *lineEditor) DeleteBackward() {
+	if editor.cursor > 0 {
+		editor.deleteBetween(editor.cursor-1, editor.cursor)
+		editor.cursor--
+	}
+}
+
+func (editor *lineEditor) DeleteForward() {
+	if editor.cursor < len(editor.text) {
+		editor.deleteBetween(editor.cursor, editor.cursor+1)
+	}
+}
+
+// DeleteToEnd removes the text from the cursor to the end of the line, returning what was removed.
+func (editor *lineEditor) DeleteToEnd() string {
+	_, end := editor.boundsOfLineContaining(editor.cursor)
+	removed := string(editor.text[editor.cursor:end])
+	editor.deleteBetween(editor.cursor, end)
+	return removed
+}
+
+// DeleteToStart removes the text from the start of the line to the cursor, returning what was removed.
+func (editor *lineEditor) DeleteToStart() string {
+	start, _ := editor.boundsOfLineContaining(editor.cursor)
+	removed := string(editor.text[start:editor.cursor])
+	editor.deleteBetween(start, editor.cursor)
+	editor.cursor = start
+	return removed
+}
+
+// DeleteWordBeforeCursor removes the word before the cursor (and any whitespace between it and the
+// cursor), returning what was removed.
+func (editor *lineEditor) DeleteWordBeforeCursor() string {
+	start := editor.startOfWordBeforeCursor()
+	removed := string(editor.text[start:editor.cursor])
+	editor.deleteBetween(start, editor.cursor)
+	editor.cursor = start
+	return removed
+}
+
+// WordBeforeCursor returns the non-whitespace runes immediately preceding the cursor, along with the
+// rune index at which they start.  If the rune before the cursor is whitespace (or the cursor is at the
+// start of the line), the word is empty and starts at the cursor.
+func (editor *lineEditor) WordBeforeCursor() (word string, startIndex int) {
+	startIndex = editor.cursor
+	for startIndex > 0 && !unicode.IsSpace(editor.text[startIndex-1]) {
+		startIndex--
+	}
+	return string(editor.text[startIndex:editor.cursor]), startIndex
+}
+
+func (editor *lineEditor) CursorIsAtEnd() bool {
+	return editor.cursor == len(editor.text)
+}
+
+func (editor *lineEditor) startOfWordBeforeCursor() int {
+	position := editor.cursor
+	for position > 0 && unicode.IsSpace(editor.text[position-1]) {
+		position--
+	}
+	for position > 0 && !unicode.IsSpace(editor.text[position-1]) {
+		position--
+	}
+	return position
+}
+
+// boundsOfLineContaining returns the rune index of the start of the line containing position, and the
+// rune index of its end (that is, of the newline that ends it, or of the end of the text).
+func (editor *lineEditor) boundsOfLineContaining(position int) (start int, end int) {
+	start = position
+	for start > 0 && editor.text[start-1] != '\n' {
+		start--
+	}
+	end = position
+	for end < len(editor.text) && editor.text[end] != '\n' {
+		end++
+	}
+	return start, end
+}
+
+func minimumOf(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (editor *lineEditor) deleteBetween(start int, end int) {
+	editor.text = append(editor.text[:start], editor.text[end:]...)
+}
@@ -0,0 +1,75 @@
+package tpcli
+
+import "sync"
+
+// orderedDeliveryQueue passes the values that are Added to it to its out channel, in the order they are Added.  Add
+// never waits for out to be read, so it may be used from the UI goroutine; values that have not been read are
+// retained.  After Close, values already Added are still passed to out, then out is closed.
+type orderedDeliveryQueue struct {
+	in     chan interface{}
+	out    chan interface{}
+	mutex  sync.Mutex
+	closed bool
+}
+
+func newOrderedDeliveryQueue() *orderedDeliveryQueue {
+	queue := &orderedDeliveryQueue{
+		in:  make(chan interface{}),
+		out: make(chan interface{}),
+	}
+
+	go queue.deliverInOrder()
+
+	return queue
+}
+
+// Add queues value for delivery.  If the queue is closed, value is discarded.
+func (queue *orderedDeliveryQueue) Add(value interface{}) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if !queue.closed {
+		queue.in <- value
+	}
+}
+
+// Close arranges for out to be closed once the values already Added have been delivered.  Close may be invoked
+// more than once.
+func (queue *orderedDeliveryQueue) Close() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if !queue.closed {
+		queue.closed = true
+		close(queue.in)
+	}
+}
+
+func (queue *orderedDeliveryQueue) deliverInOrder() {
+	var undeliveredValues []interface{}
+	in := queue.in
+
+	for in != nil || len(undeliveredValues) > 0 {
+		var outIfThereIsAValueToDeliver chan<- interface{}
+		var nextValue interface{}
+
+		if len(undeliveredValues) > 0 {
+			outIfThereIsAValueToDeliver = queue.out
+			nextValue = undeliveredValues[0]
+		}
+
+		select {
+		case value, isOpen := <-in:
+			if isOpen {
+				undeliveredValues = append(undeliveredValues, value)
+			} else {
+				in = nil
+			}
+		case outIfThereIsAValueToDeliver <- nextValue:
+			undeliveredValues[0] = nil
+			undeliveredValues = undeliveredValues[1:]
+		}
+	}
+
+	close(queue.out)
+}
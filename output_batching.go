@@ -0,0 +1,124 @@
+package tpcli
+
+import (
+	"time"
+)
+
+const defaultMaximumRedrawsPerSecond = 30
+
+// pendingOutput is text written to an output panel that has not yet been added to the panel.  The panel is
+// identified by its type, because text may be written before the panels are created by Start().  The source and the
+// time at which the text was written are retained for the panel's line decorations, and the style tag is that of the
+// text's OutputLevel (or the empty string if the text has no level).
+type pendingOutput struct {
+	panel     panelTypes
+	text      string
+	source    string
+	styleTag  string
+	writtenAt time.Time
+}
+
+// LimitingRedrawsTo sets the maximum number of times per second that the UI is redrawn because text was written to
+// the output panels.  Text written between redraws is added to the panels together, so that a stream of many writes
+// per second does not cause a redraw for each write.  The default is 30.  This must be invoked before Start().
+func (ui *Tpcli) LimitingRedrawsTo(maximumRedrawsPerSecond uint) *Tpcli {
+	if maximumRedrawsPerSecond == 0 {
+		maximumRedrawsPerSecond = 1
+	}
+	ui.minimumTimeBetweenOutputRedraws = time.Second / time.Duration(maximumRedrawsPerSecond)
+	return ui
+}
+
+// addToOutputPanel queues text to be added to the panel on the next redraw.  It may be invoked from any goroutine,
+// including the UI goroutine, before or after Start().
+func (ui *Tpcli) addToOutputPanel(panel panelTypes, source string, text string) {
+	ui.addStyledToOutputPanel(panel, "", source, text)
+}
+
+func (ui *Tpcli) addStyledToOutputPanel(panel panelTypes, styleTag string, source string, text string) {
+	writtenAt := time.Now()
+
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.pendingOutput = append(ui.pendingOutput, pendingOutput{panel: panel, text: text, source: source, styleTag: styleTag, writtenAt: writtenAt})
+	ui.scheduleOutputRedrawIfNeeded()
+}
+
+// scheduleOutputRedrawIfNeeded must be invoked while holding pendingOutputMutex.  At most one redraw is scheduled at
+// a time, so that pending output is added to the panels in the order it was written.
+func (ui *Tpcli) scheduleOutputRedrawIfNeeded() {
+	if !ui.outputRedrawsHaveStarted || ui.outputRedrawIsScheduled || !ui.hasPendingChanges() {
+		return
+	}
+
+	ui.outputRedrawIsScheduled = true
+
+	delay := ui.minimumTimeBetweenOutputRedraws - time.Since(ui.lastOutputRedraw)
+	if delay < 0 {
+		delay = 0
+	}
+
+	time.AfterFunc(delay, ui.redrawWithPendingOutput)
+}
+
+// hasPendingChanges must be invoked while holding pendingOutputMutex.
+func (ui *Tpcli) hasPendingChanges() bool {
+	return len(ui.pendingOutput) > 0 || ui.pendingCommandString != nil || ui.pendingPrompt != nil || ui.promptRefreshIsPending
+}
+
+func (ui *Tpcli) startOutputRedraws() {
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.outputRedrawsHaveStarted = true
+	ui.scheduleOutputRedrawIfNeeded()
+}
+
+func (ui *Tpcli) redrawWithPendingOutput() {
+	ui.queueUpdateDrawUnlessStopped(ui.addPendingOutputToPanels)
+
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.outputRedrawIsScheduled = false
+	ui.lastOutputRedraw = time.Now()
+	ui.scheduleOutputRedrawIfNeeded()
+}
+
+// addPendingOutputToPanels must be invoked from the UI goroutine.  It also applies the changes to the command panel
+// (from ReplaceCommandStringWith, ChangePromptTo and RefreshPrompt) made since the last redraw.
+func (ui *Tpcli) addPendingOutputToPanels() {
+	ui.applyPendingCommandPanelChanges()
+
+	ui.pendingOutputMutex.Lock()
+	outputToAdd := ui.pendingOutput
+	ui.pendingOutput = nil
+	ui.pendingOutputMutex.Unlock()
+
+	for _, output := range outputToAdd {
+		if output.panel == generalOutputPanel {
+			ui.generalOutputPanel.AppendTextFrom(output.source, output.writtenAt, output.styleTag, output.text)
+		} else {
+			ui.errorOrHistoryPanel.AppendTextFrom(output.source, output.writtenAt, output.styleTag, output.text)
+		}
+	}
+}
+
+// applyPendingCommandPanelChanges must be invoked from the UI goroutine.
+func (ui *Tpcli) applyPendingCommandPanelChanges() {
+	ui.pendingOutputMutex.Lock()
+	commandString, prompt, promptShouldBeRefreshed := ui.pendingCommandString, ui.pendingPrompt, ui.promptRefreshIsPending
+	ui.pendingCommandString, ui.pendingPrompt, ui.promptRefreshIsPending = nil, nil, false
+	ui.pendingOutputMutex.Unlock()
+
+	if prompt != nil {
+		ui.commandInputPanel.ChangePromptTo(*prompt)
+	} else if promptShouldBeRefreshed {
+		ui.commandInputPanel.refreshPromptFromProvider()
+	}
+
+	if commandString != nil {
+		ui.commandInputPanel.ChangeCommandStringTo(*commandString)
+	}
+}
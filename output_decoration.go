@@ -0,0 +1,76 @@
+package tpcli
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// uiSource is the source of text that the Tpcli itself writes to the output panels (e.g., completion candidates).
+const uiSource = "ui"
+
+// TimestampingPanelLinesUsing instructs the Tpcli to show, before each line of text in an output panel (either
+// GeneralOutputPanel or ErrorOrHistoryPanel), the time at which the text was written.  The time is formatted by
+// time.Format using layout (e.g., "15:04:05" or time.RFC3339).  An empty layout means that no time is shown, which is
+// the default.  If panel is CommandPanel, this method panics.  This must be invoked before Start().
+func (ui *Tpcli) TimestampingPanelLinesUsing(panel Panel, layout string) *Tpcli {
+	ui.settingsForOutputPanel(panel, "TimestampingPanelLinesUsing").timestampLayout = layout
+	return ui
+}
+
+// ShowingSourceTagsIn instructs the Tpcli to show, before each line of text in an output panel (after the time, if
+// the panel is timestamped), the source to which the text is attributed, in square brackets (e.g., "[peer]").  Text
+// is attributed to a source by AddStringFromSourceToGeneralOutput and AddStringFromSourceToErrorOutput.  Text that the
+// Tpcli itself writes is attributed to "ui".  Text with no source has no tag.  If panel is CommandPanel, this method
+// panics.  This must be invoked before Start().
+func (ui *Tpcli) ShowingSourceTagsIn(panel Panel) *Tpcli {
+	ui.settingsForOutputPanel(panel, "ShowingSourceTagsIn").showSourceTags = true
+	return ui
+}
+
+// AppendTextFrom appends s, as AppendText does, but first escapes it (or, if the panel translates ANSI escape
+// sequences, translates them), applies styleTag (a tview color tag, or the empty string for the default style) to
+// each line, and adds the panel's decorations for source and writtenAt to each line.
+func (panel *outputPanel) AppendTextFrom(source string, writtenAt time.Time, styleTag string, s string) {
+	if panel.translatesANSI {
+		s = translateANSIToTviewColorTags(s)
+	} else {
+		s = tview.Escape(s)
+	}
+
+	decoration := tview.Escape(panel.lineDecorationFor(source, writtenAt))
+
+	if decoration == "" && styleTag == "" {
+		if panel.translatesANSI {
+			s = panel.withPanelBackgroundInColorTags(s)
+		}
+		panel.AppendText(s)
+		return
+	}
+
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		if styleTag != "" {
+			lines[i] = styleTag + lines[i] + resetAllColorsTag
+		}
+		lines[i] = decoration + lines[i]
+	}
+
+	panel.AppendText(panel.withPanelBackgroundInColorTags(strings.Join(lines, "\n")))
+}
+
+func (panel *outputPanel) lineDecorationFor(source string, writtenAt time.Time) string {
+	var decoration strings.Builder
+
+	if panel.timestampLayout != "" {
+		decoration.WriteString(writtenAt.Format(panel.timestampLayout))
+		decoration.WriteByte(' ')
+	}
+
+	if panel.showSourceTags && source != "" {
+		decoration.WriteString("[" + source + "] ")
+	}
+
+	return decoration.String()
+}
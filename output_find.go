@@ -0,0 +1,306 @@
+package tpcli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// outputFind is the state of an output panel in find mode.  While the query is entered, the text is unchanged.  Once
+// the query is applied, the text is replaced by a copy in which each match is a highlighted region, and the original
+// text is restored when find mode ends.  The matches are found in the text as it is shown (that is, without its
+// color tags), and a line with a match is shown without its colors while the query is applied.  Like the panel's
+// text, the lines are limited to the panel's maximum, so a match is forgotten once its line is dropped.
+type outputFind struct {
+	enteringQuery       bool
+	query               string
+	queryIsARegexp      bool
+	queryIsApplied      bool
+	rawLines            []string // the panel's lines as they would be without find mode
+	matchRegionIDs      []string
+	matchLines          []int // the index in rawLines of the line with each match
+	indexOfCurrentMatch int
+	problemWithQuery    string
+}
+
+// IsFinding returns true if the panel is in find mode.
+func (panel *outputPanel) IsFinding() bool {
+	return panel.find != nil
+}
+
+// BeginFind starts find mode (or starts a new query, if the panel is already in find mode).  The query is entered
+// in the panel's title.
+func (panel *outputPanel) BeginFind() {
+	if panel.find == nil {
+		// GetText(false) ends with the (in this case, empty) text that has not yet been split into lines, after a newline
+		panel.find = &outputFind{rawLines: strings.Split(strings.TrimSuffix(panel.textView.GetText(false), "\n"), "\n")}
+	}
+
+	panel.find.enteringQuery = true
+	panel.find.query = ""
+	panel.find.problemWithQuery = ""
+	panel.showFindState()
+}
+
+// EndFind leaves find mode, restoring the panel's text (including any text appended during find mode) and title.
+func (panel *outputPanel) EndFind() {
+	if panel.find == nil {
+		return
+	}
+
+	rawText := strings.Join(panel.find.rawLines, "\n")
+	panel.find = nil
+
+	panel.textView.
+		Highlight().
+		SetRegions(false).
+		SetText(rawText).
+		ScrollToEnd().
+		SetTitle(panel.title)
+}
+
+// handleKeyDuringFind processes a key event while the panel is in find mode.  While the query is entered, printable
+// characters extend the query, ^r switches between a literal and a regular expression query, <enter> applies the
+// query and <esc> ends find mode.  Once the query is applied, 'n' and 'N' move to the next and previous match, '/'
+// starts a new query, and <esc> ends find mode.  Other keys (e.g., the arrow keys) are returned to be processed
+// normally.
+func (panel *outputPanel) handleKeyDuringFind(event *tcell.EventKey) *tcell.EventKey {
+	find := panel.find
+
+	if find.enteringQuery {
+		switch event.Key() {
+		case tcell.KeyRune:
+			find.query += string(event.Rune())
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if queryAsRunes := []rune(find.query); len(queryAsRunes) > 0 {
+				find.query = string(queryAsRunes[:len(queryAsRunes)-1])
+			}
+		case tcell.KeyCtrlR:
+			find.queryIsARegexp = !find.queryIsARegexp
+		case tcell.KeyEnter:
+			find.enteringQuery = false
+			panel.applyFindQuery()
+		case tcell.KeyEscape:
+			panel.EndFind()
+			return nil
+		default:
+			return nil
+		}
+
+		panel.showFindState()
+		return nil
+	}
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		panel.EndFind()
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'n':
+			panel.moveToMatch(+1)
+			return nil
+		case 'N':
+			panel.moveToMatch(-1)
+			return nil
+		case '/':
+			panel.BeginFind()
+			return nil
+		}
+	}
+
+	return event
+}
+
+// applyFindQuery highlights every match of the query, and moves to the last (that is, most recent) match.
+func (panel *outputPanel) applyFindQuery() {
+	find := panel.find
+
+	find.problemWithQuery = ""
+	find.matchRegionIDs = nil
+	find.matchLines = nil
+	find.indexOfCurrentMatch = 0
+
+	matchesIn, err := findMatcherFor(find.query, find.queryIsARegexp)
+	if err != nil {
+		find.problemWithQuery = "invalid pattern"
+		return
+	}
+
+	var markedUpText strings.Builder
+	for i, rawLine := range find.rawLines {
+		if i > 0 {
+			markedUpText.WriteByte('\n')
+		}
+
+		line := stripTviewColorTags(rawLine)
+
+		matches := matchesIn(line)
+		if len(matches) == 0 {
+			markedUpText.WriteString(rawLine)
+			continue
+		}
+
+		startOfUnmatchedText := 0
+		for _, match := range matches {
+			regionID := fmt.Sprintf("find-%d", len(find.matchRegionIDs))
+			find.matchRegionIDs = append(find.matchRegionIDs, regionID)
+			find.matchLines = append(find.matchLines, i)
+
+			markedUpText.WriteString(tview.Escape(line[startOfUnmatchedText:match[0]]))
+			markedUpText.WriteString(`["` + regionID + `"]` + panel.findMatchColorTags)
+			markedUpText.WriteString(tview.Escape(line[match[0]:match[1]]))
+			markedUpText.WriteString(resetAllColorsTag + `[""]`)
+			startOfUnmatchedText = match[1]
+		}
+		markedUpText.WriteString(tview.Escape(line[startOfUnmatchedText:]))
+	}
+
+	find.queryIsApplied = true
+	panel.textView.
+		SetRegions(true).
+		SetText(panel.withPanelBackgroundInColorTags(markedUpText.String()))
+
+	if len(find.matchRegionIDs) > 0 {
+		find.indexOfCurrentMatch = len(find.matchRegionIDs) - 1
+		panel.highlightCurrentMatch()
+	} else {
+		panel.textView.Highlight()
+	}
+}
+
+// findMatcherFor returns a function that returns the byte offsets of the non-empty matches of query in a line.
+func findMatcherFor(query string, queryIsARegexp bool) (func(line string) [][]int, error) {
+	if queryIsARegexp {
+		pattern, err := regexp.Compile(query)
+		if err != nil {
+			return nil, err
+		}
+		return func(line string) [][]int {
+			var nonEmptyMatches [][]int
+			for _, match := range pattern.FindAllStringIndex(line, -1) {
+				if match[1] > match[0] {
+					nonEmptyMatches = append(nonEmptyMatches, match)
+				}
+			}
+			return nonEmptyMatches
+		}, nil
+	}
+
+	return func(line string) [][]int {
+		if query == "" {
+			return nil
+		}
+		var matches [][]int
+		for offset := 0; ; {
+			index := strings.Index(line[offset:], query)
+			if index < 0 {
+				return matches
+			}
+			matches = append(matches, []int{offset + index, offset + index + len(query)})
+			offset += index + len(query)
+		}
+	}, nil
+}
+
+// moveToMatch moves to the next (direction +1) or previous (direction -1) match, wrapping around at either end.
+func (panel *outputPanel) moveToMatch(direction int) {
+	find := panel.find
+	if len(find.matchRegionIDs) == 0 {
+		return
+	}
+
+	find.indexOfCurrentMatch = (find.indexOfCurrentMatch + direction + len(find.matchRegionIDs)) % len(find.matchRegionIDs)
+	panel.highlightCurrentMatch()
+	panel.showFindState()
+}
+
+func (panel *outputPanel) highlightCurrentMatch() {
+	panel.textView.
+		Highlight(panel.find.matchRegionIDs[panel.find.indexOfCurrentMatch]).
+		ScrollToHighlight()
+}
+
+// appendTextDuringFind appends s (which already starts with a newline if there is text in the panel) while the panel
+// is in find mode.  It is not searched by the current query.  If the panel then has more than its maximum lines, the
+// oldest are dropped, along with any matches in them.
+func (panel *outputPanel) appendTextDuringFind(s string) {
+	find := panel.find
+
+	linesOfS := strings.Split(s, "\n")
+	find.rawLines[len(find.rawLines)-1] += linesOfS[0]
+	find.rawLines = append(find.rawLines, linesOfS[1:]...)
+	fmt.Fprint(panel.textView, s)
+
+	if panel.maximumLines > 0 && len(find.rawLines) > panel.maximumLines {
+		panel.dropOldestLinesDuringFind(len(find.rawLines) - panel.maximumLines)
+	}
+}
+
+// dropOldestLinesDuringFind drops lines from the start of the panel's text while it is in find mode.  The text view
+// drops them from the text it shows when it is next drawn.
+func (panel *outputPanel) dropOldestLinesDuringFind(droppedLines int) {
+	find := panel.find
+	find.rawLines = find.rawLines[droppedLines:]
+
+	droppedMatches := 0
+	for droppedMatches < len(find.matchLines) && find.matchLines[droppedMatches] < droppedLines {
+		droppedMatches++
+	}
+	find.matchRegionIDs = find.matchRegionIDs[droppedMatches:]
+	find.matchLines = find.matchLines[droppedMatches:]
+	for i := range find.matchLines {
+		find.matchLines[i] -= droppedLines
+	}
+
+	if droppedMatches == 0 {
+		return
+	}
+
+	currentMatchIsDropped := find.indexOfCurrentMatch < droppedMatches
+	find.indexOfCurrentMatch -= droppedMatches
+	if find.indexOfCurrentMatch < 0 {
+		find.indexOfCurrentMatch = 0
+	}
+
+	if find.queryIsApplied && currentMatchIsDropped {
+		if len(find.matchRegionIDs) > 0 {
+			panel.highlightCurrentMatch()
+		} else {
+			panel.textView.Highlight()
+		}
+	}
+
+	panel.showFindState()
+}
+
+// showFindState shows the query, or the matches of the applied query, in the panel's title.
+func (panel *outputPanel) showFindState() {
+	find := panel.find
+
+	queryKind := "find"
+	if find.queryIsARegexp {
+		queryKind = "find regexp"
+	}
+
+	var findState string
+	switch {
+	case find.enteringQuery:
+		findState = fmt.Sprintf("%s: %s_", queryKind, find.query)
+	case find.problemWithQuery != "":
+		findState = fmt.Sprintf("%s '%s': %s", queryKind, find.query, find.problemWithQuery)
+	case len(find.matchRegionIDs) == 0:
+		findState = fmt.Sprintf("%s '%s': no matches", queryKind, find.query)
+	default:
+		findState = fmt.Sprintf("%s '%s': %d of %d", queryKind, find.query, find.indexOfCurrentMatch+1, len(find.matchRegionIDs))
+	}
+
+	if panel.title != "" {
+		panel.textView.SetTitle(panel.title + " - " + tview.Escape(findState))
+	} else {
+		panel.textView.SetTitle(tview.Escape(findState))
+	}
+}
@@ -0,0 +1,167 @@
+package tpcli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// OutputLevel is the severity of a piece of leveled output (see AddLeveledStringToGeneralOutput).  Each level is
+// shown in its own style (see StylingOutputLevelUsing), and an output panel may hide the levels below a minimum (see
+// ShowingOutputAtOrAboveLevel).  The levels are ordered from least to most severe.
+type OutputLevel int
+
+// Output levels, from least to most severe.
+const (
+	DebugLevel OutputLevel = iota
+	InfoLevel
+	SuccessLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// outputLevelNames are the names of the output levels, in order of severity.
+var outputLevelNames = []string{"debug", "info", "success", "warn", "error"}
+
+// AsString returns the name of the level (e.g., "warn").
+func (level OutputLevel) AsString() string {
+	if level < DebugLevel || int(level) >= len(outputLevelNames) {
+		return ""
+	}
+	return outputLevelNames[level]
+}
+
+// OutputLevelNamed returns the OutputLevel with the provided name ("debug", "info", "success", "warn" or "error").
+// "warning" is accepted for "warn".  Case is ignored.  If the name is not a level, an error is returned.
+func OutputLevelNamed(name string) (OutputLevel, error) {
+	name = strings.ToLower(name)
+	if name == "warning" {
+		return WarnLevel, nil
+	}
+
+	for i, levelName := range outputLevelNames {
+		if name == levelName {
+			return OutputLevel(i), nil
+		}
+	}
+
+	return DebugLevel, fmt.Errorf("(%s) is not an output level", name)
+}
+
+func defaultOutputLevelStyles() map[OutputLevel]tcell.Style {
+	return map[OutputLevel]tcell.Style{
+		DebugLevel:   tcell.StyleDefault.Foreground(tcell.ColorGray),
+		InfoLevel:    tcell.StyleDefault,
+		SuccessLevel: tcell.StyleDefault.Foreground(tcell.ColorGreen),
+		WarnLevel:    tcell.StyleDefault.Foreground(tcell.ColorYellow),
+		ErrorLevel:   tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true),
+	}
+}
+
+// StylingOutputLevelUsing sets the style (foreground and background color, and attributes like bold and underline)
+// in which output at level is shown.  By default, debug output is gray, info output is in the panel's default style,
+// success output is green, warn output is yellow and error output is bold red.  Colors set by ANSI escape sequences
+// (see TranslatingANSIIn) take precedence over the style.  This must be invoked before output at level is added.
+func (ui *Tpcli) StylingOutputLevelUsing(level OutputLevel, style tcell.Style) *Tpcli {
+	ui.outputLevelStyles[level] = style
+	return ui
+}
+
+// ShowingOutputAtOrAboveLevel instructs the Tpcli to discard leveled output written to an output panel (either
+// GeneralOutputPanel or ErrorOrHistoryPanel) if its level is below minimumLevel.  By default, output at every level
+// is shown.  Output added without a level (e.g., by AddStringToGeneralOutput) is always shown.  If panel is
+// CommandPanel, this method panics.  This must be invoked before Start().
+func (ui *Tpcli) ShowingOutputAtOrAboveLevel(panel Panel, minimumLevel OutputLevel) *Tpcli {
+	ui.settingsForOutputPanel(panel, "ShowingOutputAtOrAboveLevel").minimumLevel = minimumLevel
+	return ui
+}
+
+// AddLeveledStringToGeneralOutput is the same as AddStringToGeneralOutput, but the content is shown in the style of
+// level, and is discarded if level is below the panel's minimum level.
+func (ui *Tpcli) AddLeveledStringToGeneralOutput(level OutputLevel, additionalContent string) {
+	ui.AddLeveledStringFromSourceToGeneralOutput(level, "", additionalContent)
+}
+
+// AddLeveledStringFromSourceToGeneralOutput is the same as AddLeveledStringToGeneralOutput, but the content is
+// attributed to a source, as with AddStringFromSourceToGeneralOutput.
+func (ui *Tpcli) AddLeveledStringFromSourceToGeneralOutput(level OutputLevel, source string, additionalContent string) {
+	ui.addLeveledToOutputPanel(generalOutputPanel, level, source, additionalContent)
+}
+
+// AddLeveledStringToErrorOutput is the same as AddStringToErrorOutput, but the content is shown in the style of
+// level, and is discarded if level is below the minimum level of the panel to which it is written.
+func (ui *Tpcli) AddLeveledStringToErrorOutput(level OutputLevel, additionalContent string) {
+	ui.AddLeveledStringFromSourceToErrorOutput(level, "", additionalContent)
+}
+
+// AddLeveledStringFromSourceToErrorOutput is the same as AddLeveledStringToErrorOutput, but the content is
+// attributed to a source, as with AddStringFromSourceToErrorOutput.
+func (ui *Tpcli) AddLeveledStringFromSourceToErrorOutput(level OutputLevel, source string, additionalContent string) {
+	ui.addLeveledToOutputPanel(ui.panelForErrorOutput(), level, source, additionalContent)
+}
+
+func (ui *Tpcli) addLeveledToOutputPanel(panel panelTypes, level OutputLevel, source string, text string) {
+	settings := ui.outputPanelSettings[GeneralOutputPanel]
+	if panel == errorOrHistoryPanel {
+		settings = ui.outputPanelSettings[ErrorOrHistoryPanel]
+	}
+
+	if level < settings.minimumLevel {
+		return
+	}
+
+	ui.addStyledToOutputPanel(panel, tviewColorTagFor(ui.outputLevelStyles[level]), source, text)
+}
+
+// tviewColorTagFor returns the tview color tag which sets style, or the empty string for tcell.StyleDefault.
+func tviewColorTagFor(style tcell.Style) string {
+	if style == tcell.StyleDefault {
+		return ""
+	}
+
+	foreground, background, attributes := style.Decompose()
+
+	attributeFlags := ""
+	for _, flag := range []struct {
+		attribute tcell.AttrMask
+		flag      string
+	}{
+		{tcell.AttrBlink, "l"},
+		{tcell.AttrBold, "b"},
+		{tcell.AttrDim, "d"},
+		{tcell.AttrReverse, "r"},
+		{tcell.AttrUnderline, "u"},
+	} {
+		if attributes&flag.attribute != 0 {
+			attributeFlags += flag.flag
+		}
+	}
+	if attributeFlags == "" {
+		attributeFlags = "-"
+	}
+
+	return fmt.Sprintf("[%s:%s:%s]", tviewColorNameFor(foreground), tviewColorNameFor(background), attributeFlags)
+}
+
+// tviewColorNameFor returns the name of color in a tview color tag: its tcell name if it has one, otherwise its
+// #rrggbb value, or "-" for tcell.ColorDefault.
+func tviewColorNameFor(color tcell.Color) string {
+	if color == tcell.ColorDefault || color.Hex() < 0 {
+		return "-"
+	}
+
+	var names []string
+	for name, namedColor := range tcell.ColorNames {
+		if namedColor == color {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0]
+	}
+
+	return fmt.Sprintf("#%06x", color.Hex())
+}
@@ -0,0 +1,260 @@
+package tpcli
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+const (
+	panelsPageName         = "panels"
+	maximizedPanelPageName = "maximizedPanel"
+
+	// minimumOutputPanelRows is the height of an output panel that shows one line of text inside its border.
+	minimumOutputPanelRows = 3
+)
+
+// PanelSize is the height of a panel: either a fixed number of rows (see FixedRows) or a proportion of the rows that
+// remain after the panels with fixed sizes are laid out (see ProportionOfRemainingRows).
+type PanelSize struct {
+	rows       uint
+	proportion uint // 0 unless the size is a proportion
+}
+
+// FixedRows returns the size of a panel that is always the provided number of rows high (at least 1).
+func FixedRows(rows uint) PanelSize {
+	if rows == 0 {
+		rows = 1
+	}
+	return PanelSize{rows: rows}
+}
+
+// ProportionOfRemainingRows returns the size of a panel that shares the rows left by the panels with fixed sizes
+// with the other proportionally sized panels, in proportion to weight (at least 1).  For example, if one panel has a
+// weight of 2 and another has a weight of 1, the first receives two thirds of the remaining rows.
+func ProportionOfRemainingRows(weight uint) PanelSize {
+	if weight == 0 {
+		weight = 1
+	}
+	return PanelSize{proportion: weight}
+}
+
+// IsProportional returns true if the size is a proportion of the remaining rows, rather than a fixed number of rows.
+func (size PanelSize) IsProportional() bool {
+	return size.proportion > 0
+}
+
+func defaultPanelSizes() map[Panel]PanelSize {
+	return map[Panel]PanelSize{
+		GeneralOutputPanel:  ProportionOfRemainingRows(1),
+		ErrorOrHistoryPanel: FixedRows(12),
+		CommandPanel:        FixedRows(defaultCommandPanelRows),
+	}
+}
+
+// SizingPanel sets the height of a panel.  By default, the general output panel takes the rows left by the other
+// panels, the error (or command history) panel is 12 rows and the command panel is 3 rows.  The command panel must
+// have a fixed size (if multi-line command input is used, it grows beyond that size to show each line of a command,
+// up to 10 rows); otherwise, this method panics.  The sizes may be changed while the UI runs with the GrowFocusedPanel,
+// ShrinkFocusedPanel and ToggleMaximizedPanel key actions.  This must be invoked before Start().
+func (ui *Tpcli) SizingPanel(panel Panel, size PanelSize) *Tpcli {
+	if panel == CommandPanel && size.IsProportional() {
+		panic("SizingPanel invoked with a proportional size for CommandPanel")
+	}
+
+	if _, isAPanel := ui.panelSizes[panel]; !isAPanel {
+		panic(fmt.Sprintf("SizingPanel invoked for an unknown panel (%d)", panel))
+	}
+
+	ui.panelSizes[panel] = size
+	return ui
+}
+
+// commandPanelRows returns the height of the command panel, which grows beyond its size to show each line of a
+// multi-line command.
+func (ui *Tpcli) commandPanelRows() int {
+	rows := int(ui.panelSizes[CommandPanel].rows)
+
+	maximumRows := maximumCommandPanelRows
+	if rows > maximumRows {
+		maximumRows = rows
+	}
+
+	if ui.linesInCommand > rows {
+		rows = ui.linesInCommand
+		if rows > maximumRows {
+			rows = maximumRows
+		}
+	}
+
+	return rows
+}
+
+// layOutPanels applies the panel sizes to the layout (and to the grid of a maximized panel, if there is one).  This
+// must be invoked from the tview event loop once the UI has started.
+func (ui *Tpcli) layOutPanels() {
+	ui.sizeElementsOf(ui.layout)
+
+	if ui.maximizedPanel != nil {
+		ui.sizeMaximizedPanelGrid()
+	}
+}
+
+// resizeFocusedPanelBy grows (if rows is positive) or shrinks (if rows is negative) the panel with focus.  If the panel
+// has a fixed size, it changes by that many rows.  If it has a proportional size, the other output panel changes
+// instead if that panel has a fixed size and is not side by side with the panel; otherwise, the panel's weight changes.
+// A panel does not shrink below its minimum height, and does not grow if the other panels would not fit.
+func (ui *Tpcli) resizeFocusedPanelBy(rows int) {
+	panel := ui.panelWithFocus()
+
+	if size := ui.panelSizes[panel]; size.IsProportional() {
+		otherOutputPanel := GeneralOutputPanel
+		if panel == GeneralOutputPanel {
+			otherOutputPanel = ErrorOrHistoryPanel
+		}
+
+		if ui.panelSizes[otherOutputPanel].IsProportional() || ui.layout.arrangementSeparating(panel, otherOutputPanel) == sideBySide {
+			if weight := int(size.proportion) + rows; weight >= 1 {
+				ui.panelSizes[panel] = ProportionOfRemainingRows(uint(weight))
+			}
+		} else {
+			ui.resizeFixedPanelBy(otherOutputPanel, -rows)
+		}
+	} else {
+		ui.resizeFixedPanelBy(panel, rows)
+	}
+
+	ui.layOutPanels()
+}
+
+func (ui *Tpcli) resizeFixedPanelBy(panel Panel, rows int) {
+	minimumRows := minimumOutputPanelRows
+	if panel == CommandPanel {
+		minimumRows = 1
+	}
+
+	newRows := int(ui.panelSizes[panel].rows) + rows
+	if newRows < minimumRows {
+		return
+	}
+
+	if rows > 0 {
+		_, _, _, availableRows := ui.uiPages.GetInnerRect()
+		if ui.minimumRowsOf(ui.layout)+rows > availableRows {
+			return
+		}
+	}
+
+	ui.panelSizes[panel] = FixedRows(uint(newRows))
+}
+
+// toggleMaximizedPanel maximizes the output panel with focus (or the general output panel, if the command panel has
+// focus), so that it and the command panel are the only panels shown, or restores the panels if a panel is
+// maximized.
+func (ui *Tpcli) toggleMaximizedPanel() {
+	if ui.maximizedPanel != nil {
+		ui.uiPages.RemovePage(maximizedPanelPageName).ShowPage(panelsPageName)
+		ui.maximizedPanel, ui.maximizedPanelGrid = nil, nil
+		return
+	}
+
+	if focusedOutputPanel := ui.focusedOutputPanel(); focusedOutputPanel != nil {
+		ui.maximize(focusedOutputPanel)
+	} else {
+		ui.maximize(ui.generalOutputPanel)
+	}
+}
+
+// maximize shows panel and the command panel in place of the panels, keeping their order, and keeping them side by
+// side if they are side by side in the layout (otherwise, they are stacked).
+func (ui *Tpcli) maximize(panel *outputPanel) {
+	ui.maximizedPanel = panel
+	ui.maximizedPanelGrid = tview.NewGrid()
+	ui.sizeMaximizedPanelGrid()
+
+	outputCell, commandCell := 0, 1
+	if ui.commandPanelPrecedesMaximizedPanel() {
+		outputCell, commandCell = 1, 0
+	}
+
+	if ui.commandPanelIsBesideMaximizedPanel() {
+		ui.maximizedPanelGrid.
+			AddItem(panel.BackingTviewObject(), 0, outputCell, 1, 1, 0, 0, false).
+			AddItem(ui.commandInputPanel.BackingTviewObject(), 0, commandCell, 1, 1, 0, 0, false)
+	} else {
+		ui.maximizedPanelGrid.
+			AddItem(panel.BackingTviewObject(), outputCell, 0, 1, 1, 0, 0, false).
+			AddItem(ui.commandInputPanel.BackingTviewObject(), commandCell, 0, 1, 1, 0, 0, false)
+	}
+
+	ui.uiPages.
+		RemovePage(maximizedPanelPageName).
+		AddPage(maximizedPanelPageName, ui.maximizedPanelGrid, true, true).
+		HidePage(panelsPageName)
+}
+
+// sizeMaximizedPanelGrid sets the rows and columns of the grid showing the maximized panel.  If the panel and the
+// command panel are side by side, they share the columns in proportion to their width weights in the layout;
+// otherwise, the command panel has its usual rows.
+func (ui *Tpcli) sizeMaximizedPanelGrid() {
+	var sizes []int
+	panelsAreSideBySide := ui.commandPanelIsBesideMaximizedPanel()
+
+	if panelsAreSideBySide {
+		partWithBothPanels := ui.layout.partSeparating(CommandPanel, ui.maximizedPanelInLayout())
+		sizes = []int{
+			-partWithBothPanels.elementIncluding(ui.maximizedPanelInLayout()).widthProportion(),
+			-partWithBothPanels.elementIncluding(CommandPanel).widthProportion(),
+		}
+	} else {
+		sizes = []int{0, ui.commandPanelRows()}
+	}
+
+	if ui.commandPanelPrecedesMaximizedPanel() {
+		sizes[0], sizes[1] = sizes[1], sizes[0]
+	}
+
+	if panelsAreSideBySide {
+		ui.maximizedPanelGrid.SetRows(0).SetColumns(sizes...)
+	} else {
+		ui.maximizedPanelGrid.SetRows(sizes...).SetColumns(0)
+	}
+}
+
+func (ui *Tpcli) maximizedPanelInLayout() Panel {
+	if ui.maximizedPanel == ui.errorOrHistoryPanel {
+		return ErrorOrHistoryPanel
+	}
+	return GeneralOutputPanel
+}
+
+func (ui *Tpcli) commandPanelIsBesideMaximizedPanel() bool {
+	return ui.layout.arrangementSeparating(CommandPanel, ui.maximizedPanelInLayout()) == sideBySide
+}
+
+func (ui *Tpcli) commandPanelPrecedesMaximizedPanel() bool {
+	maximizedPanelType := typeOfPanel(ui.maximizedPanelInLayout())
+
+	for _, panelType := range ui.panelTypesInOrder {
+		switch panelType {
+		case commandPanel:
+			return true
+		case maximizedPanelType:
+			return false
+		}
+	}
+
+	return false
+}
+
+// keepFocusedPanelMaximized is invoked after focus moves.  If a panel is maximized and focus has moved to the other
+// output panel (which is hidden), that panel is maximized instead.
+func (ui *Tpcli) keepFocusedPanelMaximized() {
+	if ui.maximizedPanel == nil {
+		return
+	}
+
+	if focusedOutputPanel := ui.focusedOutputPanel(); focusedOutputPanel != nil && focusedOutputPanel != ui.maximizedPanel {
+		ui.maximize(focusedOutputPanel)
+	}
+}
@@ -1,6 +1,9 @@
 package tpcli
 
 import (
+	"regexp"
+	"strings"
+
 	"github.com/blorticus/stringcque"
 )
 
@@ -12,8 +15,14 @@ import (
 // Down from this empty string, the empty string is returned and the iterator does not move.  If items are added, ResetIteration()
 // should be called before trying to move Up or Down.  If this is not done, the results are undefined.
 type ReadlineHistory struct {
-	attachedQueue           *stringcque.SimpleStringCircularQueue
-	indexOfLastItemReturned int // -1 is the implicit empty string entry at the bottom of the inverted stack
+	attachedQueue            *stringcque.SimpleStringCircularQueue
+	indexOfLastItemReturned  int // -1 is the implicit empty string entry at the bottom of the inverted stack
+	maximumEntries           uint
+	persistenceFilePath      string // empty unless PersistToFile has been invoked
+	entriesInPersistenceFile uint
+	fileErrorHandler         func(err error)
+	control                  HistoryControl
+	ignoredItemPatterns      []*regexp.Regexp
 }
 
 // NewReadlineHistory creates a ReadlineHistory which will contain up to maximumHistoryEntries items.  If the stack already has that number of
@@ -22,6 +31,8 @@ func NewReadlineHistory(maximumHistoryEntries uint) *ReadlineHistory {
 	return &ReadlineHistory{
 		attachedQueue:           stringcque.NewSimpleStringCircularBuffer(int(maximumHistoryEntries)),
 		indexOfLastItemReturned: -1,
+		maximumEntries:          maximumHistoryEntries,
+		fileErrorHandler:        func(error) {},
 	}
 }
 
@@ -65,13 +76,89 @@ func (history *ReadlineHistory) Down() string {
 	return value
 }
 
+// UpWithPrefix is like Up, but it skips any item that does not start with prefix.  If there is no item above the
+// current iterator location that starts with prefix, the iterator does not move, and the item at the current location is
+// returned (which is the implicit empty string entry if the iterator is at the bottom of the inverted stack).
+func (history *ReadlineHistory) UpWithPrefix(prefix string) string {
+	startingIndex := history.normalizedIteratorIndex()
+
+	for index := startingIndex - 1; index >= 0; index-- {
+		if item, _ := history.attachedQueue.GetItemAtIndex(uint(index)); strings.HasPrefix(item, prefix) {
+			history.indexOfLastItemReturned = index
+			return item
+		}
+	}
+
+	item, _ := history.attachedQueue.GetItemAtIndex(uint(startingIndex))
+	return item
+}
+
+// DownWithPrefix is like Down, but it skips any item that does not start with prefix.  If there is no item below the
+// current iterator location that starts with prefix, the iterator moves to the implicit empty string entry at the
+// bottom of the inverted stack, and the empty string is returned.
+func (history *ReadlineHistory) DownWithPrefix(prefix string) string {
+	numberOfItems := int(history.attachedQueue.NumberOfItemsInTheQueue())
+
+	for index := history.normalizedIteratorIndex() + 1; index < numberOfItems; index++ {
+		if item, _ := history.attachedQueue.GetItemAtIndex(uint(index)); strings.HasPrefix(item, prefix) {
+			history.indexOfLastItemReturned = index
+			return item
+		}
+	}
+
+	history.indexOfLastItemReturned = numberOfItems
+	return ""
+}
+
+// SearchUp moves the iterator up the inverted stack to the nearest item above the current iterator location that
+// contains substring, returning that item.  If no item above the current location contains substring, the iterator
+// does not move, and found is false.
+func (history *ReadlineHistory) SearchUp(substring string) (item string, found bool) {
+	for index := history.normalizedIteratorIndex() - 1; index >= 0; index-- {
+		if item, _ := history.attachedQueue.GetItemAtIndex(uint(index)); strings.Contains(item, substring) {
+			history.indexOfLastItemReturned = index
+			return item, true
+		}
+	}
+
+	return "", false
+}
+
 // ResetIteration returns the iterator to the last entry in the inverted stack, which is always the implicit
 // empty string entry.
 func (history *ReadlineHistory) ResetIteration() {
 	history.indexOfLastItemReturned = int(history.attachedQueue.NumberOfItemsInTheQueue())
 }
 
-// AddItem adds an item to the end of the inverted stack.
+// normalizedIteratorIndex returns the iterator location, treating an iterator that has never been reset as
+// being at the implicit empty string entry at the bottom of the inverted stack.
+func (history *ReadlineHistory) normalizedIteratorIndex() int {
+	if history.indexOfLastItemReturned < 0 {
+		return int(history.attachedQueue.NumberOfItemsInTheQueue())
+	}
+	return history.indexOfLastItemReturned
+}
+
+// AddItem adds an item to the end of the inverted stack.  Whitespace surrounding the item is removed first.  The item is
+// ignored if it is then empty, or if it is excluded by a policy set using UsingHistoryControl or IgnoringItemsMatching.
+// If PersistToFile has been invoked, the item is also appended to the history file.
 func (history *ReadlineHistory) AddItem(item string) {
-	history.attachedQueue.PutItemAtEnd(item)
+	trimmedItem := strings.TrimSpace(item)
+	if history.shouldIgnore(item, trimmedItem) {
+		return
+	}
+
+	olderDuplicatesWereErased := history.control&EraseOlderDuplicates != 0 && history.eraseItemsEqualTo(trimmedItem)
+
+	history.attachedQueue.PutItemAtEnd(trimmedItem)
+
+	if history.persistenceFilePath != "" {
+		if olderDuplicatesWereErased {
+			if err := history.rewritePersistenceFile(); err != nil {
+				history.fileErrorHandler(err)
+			}
+		} else {
+			history.appendToPersistenceFile(trimmedItem)
+		}
+	}
 }
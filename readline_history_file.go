@@ -0,0 +1,121 @@
+package tpcli
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PersistToFile loads any entries already in the history file at filePath, then arranges for each item subsequently
+// added (via AddItem) to be appended to that file immediately, so that a crash does not lose the session's history.
+// The file has one entry per line.  A newline embedded in an entry is written as the two characters \n, and a
+// backslash is written as \\.  If the file contains more entries than this ReadlineHistory may hold, only the most
+// recent are loaded.  The file is rewritten to contain only the entries in this ReadlineHistory when it is loaded, and
+// again whenever an item is added once the file holds the maximum number of entries, so that the file never holds
+// more than the maximum.  If the file does not exist, it is created.  An error is returned if the file cannot be read or rewritten.  Errors that
+// occur when later appending to the file are delivered to the callback provided to OnFileError.
+func (history *ReadlineHistory) PersistToFile(filePath string) error {
+	fileContents, err := ioutil.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, line := range strings.Split(string(fileContents), "\n") {
+		if line != "" {
+			history.attachedQueue.PutItemAtEnd(unescapeHistoryFileEntry(line))
+		}
+	}
+	history.ResetIteration()
+
+	history.persistenceFilePath = filePath
+
+	return history.rewritePersistenceFile()
+}
+
+// OnFileError sets a callback which is executed each time an error occurs while appending an item to the history
+// file provided to PersistToFile.
+func (history *ReadlineHistory) OnFileError(callback func(err error)) *ReadlineHistory {
+	history.fileErrorHandler = callback
+	return history
+}
+
+func (history *ReadlineHistory) appendToPersistenceFile(item string) {
+	if history.entriesInPersistenceFile >= history.maximumEntries {
+		if err := history.rewritePersistenceFile(); err != nil {
+			history.fileErrorHandler(err)
+		}
+		return
+	}
+
+	fileHandle, err := os.OpenFile(history.persistenceFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		history.fileErrorHandler(err)
+		return
+	}
+	defer fileHandle.Close()
+
+	if _, err := fileHandle.WriteString(escapeHistoryFileEntry(item) + "\n"); err != nil {
+		history.fileErrorHandler(err)
+		return
+	}
+
+	history.entriesInPersistenceFile++
+}
+
+// rewritePersistenceFile replaces the history file with the current entries.  The entries are written to a temporary
+// file in the same directory, which is then renamed, so that the history file is never left partially written.
+func (history *ReadlineHistory) rewritePersistenceFile() error {
+	temporaryFile, err := ioutil.TempFile(filepath.Dir(history.persistenceFilePath), ".tpcli-history-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	writer := bufio.NewWriter(temporaryFile)
+	for i := uint(0); i < history.attachedQueue.NumberOfItemsInTheQueue(); i++ {
+		item, _ := history.attachedQueue.GetItemAtIndex(i)
+		writer.WriteString(escapeHistoryFileEntry(item) + "\n")
+	}
+
+	if err := writer.Flush(); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryFile.Name(), history.persistenceFilePath); err != nil {
+		return err
+	}
+
+	history.entriesInPersistenceFile = history.attachedQueue.NumberOfItemsInTheQueue()
+	return nil
+}
+
+func escapeHistoryFileEntry(entry string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(entry)
+}
+
+func unescapeHistoryFileEntry(line string) string {
+	var unescaped strings.Builder
+
+	escaping := false
+	for _, r := range line {
+		switch {
+		case escaping && r == 'n':
+			unescaped.WriteRune('\n')
+			escaping = false
+		case escaping:
+			unescaped.WriteRune(r)
+			escaping = false
+		case r == '\\':
+			escaping = true
+		default:
+			unescaped.WriteRune(r)
+		}
+	}
+
+	return unescaped.String()
+}
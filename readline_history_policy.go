@@ -0,0 +1,98 @@
+package tpcli
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/blorticus/stringcque"
+)
+
+// HistoryControl is a set of policies that determine which items a ReadlineHistory retains, much like bash's
+// HISTCONTROL.  Policies are combined using '|' (e.g., IgnoreConsecutiveDuplicates | IgnoreItemsStartingWithSpace).
+type HistoryControl uint
+
+const (
+	// IgnoreConsecutiveDuplicates causes an item that is the same as the most recently added item to be ignored.
+	IgnoreConsecutiveDuplicates HistoryControl = 1 << iota
+
+	// EraseOlderDuplicates causes every item that is the same as the item being added to be removed before the
+	// item is added, so that each distinct item appears only once, in the position at which it was last added.
+	EraseOlderDuplicates
+
+	// IgnoreItemsStartingWithSpace causes an item that starts with a whitespace character to be ignored.
+	IgnoreItemsStartingWithSpace
+)
+
+// UsingHistoryControl sets the policies applied when an item is added.  By default, no policies are applied.
+func (history *ReadlineHistory) UsingHistoryControl(control HistoryControl) *ReadlineHistory {
+	history.control = control
+	return history
+}
+
+// IgnoringItemsMatching causes an item that matches the pattern to be ignored when it is added.  This is useful for
+// keeping commands that contain sensitive information (like passwords) out of the history.  'pattern' may be either a
+// string or a *regexp.Regexp.  If it is a string, then it is fed to regexp.MustCompile (and will panic if the
+// compilation fails).  If it is neither type, this method panics.  This may be invoked more than once, in which case an
+// item matching any of the patterns is ignored.
+func (history *ReadlineHistory) IgnoringItemsMatching(pattern interface{}) *ReadlineHistory {
+	history.ignoredItemPatterns = append(history.ignoredItemPatterns, regexpFromStringOrRegexp(pattern, "IgnoringItemsMatching"))
+	return history
+}
+
+// shouldIgnore applies the ignore policies to an item as it was provided to AddItem (that is, before surrounding
+// whitespace is removed).
+func (history *ReadlineHistory) shouldIgnore(itemAsProvided string, trimmedItem string) bool {
+	if trimmedItem == "" {
+		return true
+	}
+
+	if history.control&IgnoreItemsStartingWithSpace != 0 && strings.TrimLeftFunc(itemAsProvided, unicode.IsSpace) != itemAsProvided {
+		return true
+	}
+
+	if history.control&IgnoreConsecutiveDuplicates != 0 && !history.attachedQueue.IsEmpty() {
+		if mostRecentItem, _ := history.attachedQueue.GetItemAtIndex(history.attachedQueue.NumberOfItemsInTheQueue() - 1); mostRecentItem == trimmedItem {
+			return true
+		}
+	}
+
+	for _, pattern := range history.ignoredItemPatterns {
+		if pattern.MatchString(trimmedItem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eraseItemsEqualTo removes every item that is the same as item, returning true if any item was removed.  The
+// underlying queue does not support removal, so it is rebuilt.
+func (history *ReadlineHistory) eraseItemsEqualTo(item string) bool {
+	numberOfItems := history.attachedQueue.NumberOfItemsInTheQueue()
+	retainedQueue := stringcque.NewSimpleStringCircularBuffer(int(history.maximumEntries))
+
+	for i := uint(0); i < numberOfItems; i++ {
+		if existingItem, _ := history.attachedQueue.GetItemAtIndex(i); existingItem != item {
+			retainedQueue.PutItemAtEnd(existingItem)
+		}
+	}
+
+	if retainedQueue.NumberOfItemsInTheQueue() == numberOfItems {
+		return false
+	}
+
+	history.attachedQueue = retainedQueue
+	return true
+}
+
+func regexpFromStringOrRegexp(pattern interface{}, nameOfInvokingMethod string) *regexp.Regexp {
+	switch typedPattern := pattern.(type) {
+	case *regexp.Regexp:
+		return typedPattern
+	case string:
+		return regexp.MustCompile(typedPattern)
+	default:
+		panic(nameOfInvokingMethod + " invoked with a pattern that is neither a string nor a *regexp.Regexp")
+	}
+}
@@ -1,8 +1,12 @@
 package tpcli_test
 
 import (
-	//"fmt"
-	//"regexp"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/blorticus/tpcli"
 
@@ -84,4 +88,224 @@ var _ = Describe("readline_history", func() {
 			Expect(item).To(Equal(""))
 		})
 	})
+
+	Context("searching readline with four entries", func() {
+		JustBeforeEach(func() {
+			readlineHistory.AddItem("connect to foo")
+			readlineHistory.AddItem("read file")
+			readlineHistory.AddItem("connect to bar")
+			readlineHistory.AddItem("quit")
+			readlineHistory.ResetIteration()
+		})
+
+		It("should find successively older matching items", func() {
+			item, found := readlineHistory.SearchUp("connect")
+			Expect(found).To(BeTrue())
+			Expect(item).To(Equal("connect to bar"))
+
+			item, found = readlineHistory.SearchUp("connect")
+			Expect(found).To(BeTrue())
+			Expect(item).To(Equal("connect to foo"))
+
+			_, found = readlineHistory.SearchUp("connect")
+			Expect(found).To(BeFalse())
+		})
+
+		It("should not move the iterator if there is no match", func() {
+			readlineHistory.Up()
+			readlineHistory.Up()
+
+			_, found := readlineHistory.SearchUp("quit")
+			Expect(found).To(BeFalse())
+			Expect(readlineHistory.Down()).To(Equal("quit"))
+		})
+
+		It("should move Up and Down only through items with a prefix", func() {
+			Expect(readlineHistory.UpWithPrefix("connect")).To(Equal("connect to bar"))
+			Expect(readlineHistory.UpWithPrefix("connect")).To(Equal("connect to foo"))
+
+			By("not moving past the top")
+			Expect(readlineHistory.UpWithPrefix("connect")).To(Equal("connect to foo"))
+
+			Expect(readlineHistory.DownWithPrefix("connect")).To(Equal("connect to bar"))
+
+			By("moving to the implicit empty entry at the bottom")
+			Expect(readlineHistory.DownWithPrefix("connect")).To(Equal(""))
+			Expect(readlineHistory.DownWithPrefix("connect")).To(Equal(""))
+			Expect(readlineHistory.Up()).To(Equal("quit"))
+		})
+
+		It("should not move Up if no item has the prefix", func() {
+			Expect(readlineHistory.UpWithPrefix("write")).To(Equal(""))
+			Expect(readlineHistory.Up()).To(Equal("quit"))
+		})
+
+		It("should leave the iterator at the match", func() {
+			readlineHistory.SearchUp("read")
+			Expect(readlineHistory.Down()).To(Equal("connect to bar"))
+		})
+	})
+
+	Context("with history control policies", func() {
+		itemsOldestFirst := func() []string {
+			readlineHistory.ResetIteration()
+			for i := 0; i < 10; i++ {
+				readlineHistory.Up()
+			}
+
+			items := []string{readlineHistory.Up()}
+			for item := readlineHistory.Down(); item != ""; item = readlineHistory.Down() {
+				items = append(items, item)
+			}
+			return items
+		}
+
+		It("should ignore empty and whitespace-only items and trim added items", func() {
+			readlineHistory.AddItem("")
+			readlineHistory.AddItem("  \t ")
+			readlineHistory.AddItem("  first  ")
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"first"}))
+		})
+
+		It("should retain duplicates if no policy is set", func() {
+			readlineHistory.AddItem("a")
+			readlineHistory.AddItem("a")
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"a", "a"}))
+		})
+
+		It("should ignore consecutive duplicates", func() {
+			readlineHistory.UsingHistoryControl(tpcli.IgnoreConsecutiveDuplicates)
+			for _, item := range []string{"a", "a", "b", " a", "a"} {
+				readlineHistory.AddItem(item)
+			}
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"a", "b", "a"}))
+		})
+
+		It("should erase older duplicates", func() {
+			readlineHistory.UsingHistoryControl(tpcli.EraseOlderDuplicates)
+			for _, item := range []string{"a", "b", "a", "c", "b"} {
+				readlineHistory.AddItem(item)
+			}
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"a", "c", "b"}))
+		})
+
+		It("should ignore items starting with whitespace", func() {
+			readlineHistory.UsingHistoryControl(tpcli.IgnoreItemsStartingWithSpace | tpcli.IgnoreConsecutiveDuplicates)
+			readlineHistory.AddItem("a")
+			readlineHistory.AddItem(" secret")
+			readlineHistory.AddItem("\tsecret")
+			readlineHistory.AddItem("b ")
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"a", "b"}))
+		})
+
+		It("should ignore items matching any provided pattern", func() {
+			readlineHistory.
+				IgnoringItemsMatching(`(?i)password`).
+				IgnoringItemsMatching(regexp.MustCompile(`^login\s`))
+			for _, item := range []string{"set Password x", "login bob pw", "show"} {
+				readlineHistory.AddItem(item)
+			}
+
+			Expect(itemsOldestFirst()).To(Equal([]string{"show"}))
+		})
+
+		It("should panic if a pattern is neither a string nor a *regexp.Regexp", func() {
+			Expect(func() { readlineHistory.IgnoringItemsMatching(10) }).To(Panic())
+		})
+	})
+
+	Context("persisted to a file", func() {
+		var (
+			historyDirectory string
+			historyFilePath  string
+		)
+
+		BeforeEach(func() {
+			var err error
+			historyDirectory, err = ioutil.TempDir("", "tpcli-history-test-")
+			Expect(err).ShouldNot(HaveOccurred())
+			historyFilePath = filepath.Join(historyDirectory, "history")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(historyDirectory)
+		})
+
+		It("should create the file if it does not exist and append each added item", func() {
+			Expect(readlineHistory.PersistToFile(historyFilePath)).To(Succeed())
+
+			readlineHistory.AddItem("first item")
+			readlineHistory.AddItem("multi\nline \\ item")
+
+			contents, err := ioutil.ReadFile(historyFilePath)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("first item\nmulti\\nline \\\\ item\n"))
+		})
+
+		It("should load the most recent entries from an existing file and trim it", func() {
+			lines := ""
+			for i := 1; i <= 12; i++ {
+				lines += fmt.Sprintf("item %d\n", i)
+			}
+			lines += "multi\\nline\n"
+			Expect(ioutil.WriteFile(historyFilePath, []byte(lines), 0600)).To(Succeed())
+
+			Expect(readlineHistory.PersistToFile(historyFilePath)).To(Succeed())
+
+			Expect(readlineHistory.Up()).To(Equal("multi\nline"))
+			Expect(readlineHistory.Up()).To(Equal("item 12"))
+
+			contents, err := ioutil.ReadFile(historyFilePath)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(strings.Split(strings.TrimSpace(string(contents)), "\n")).To(HaveLen(10))
+			Expect(string(contents)).To(HavePrefix("item 4\n"))
+		})
+
+		It("should trim the file to the maximum as items are added", func() {
+			Expect(readlineHistory.PersistToFile(historyFilePath)).To(Succeed())
+
+			for i := 1; i <= 25; i++ {
+				readlineHistory.AddItem(fmt.Sprintf("item %d", i))
+
+				contents, err := ioutil.ReadFile(historyFilePath)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(len(strings.Split(strings.TrimSpace(string(contents)), "\n"))).To(BeNumerically("<=", 10))
+			}
+
+			contents, err := ioutil.ReadFile(historyFilePath)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(strings.Split(strings.TrimSpace(string(contents)), "\n")).To(HaveLen(10))
+			Expect(string(contents)).To(HavePrefix("item 16\n"))
+			Expect(string(contents)).To(HaveSuffix("item 25\n"))
+		})
+
+		It("should rewrite the file when older duplicates are erased", func() {
+			readlineHistory.UsingHistoryControl(tpcli.EraseOlderDuplicates)
+			Expect(readlineHistory.PersistToFile(historyFilePath)).To(Succeed())
+
+			for _, item := range []string{"a", "b", "a"} {
+				readlineHistory.AddItem(item)
+			}
+
+			contents, err := ioutil.ReadFile(historyFilePath)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("b\na\n"))
+		})
+
+		It("should deliver append errors to the file error callback", func() {
+			var deliveredError error
+			readlineHistory.OnFileError(func(err error) { deliveredError = err })
+			Expect(readlineHistory.PersistToFile(historyFilePath)).To(Succeed())
+
+			os.RemoveAll(historyDirectory)
+			readlineHistory.AddItem("first item")
+
+			Expect(deliveredError).Should(HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,105 @@
+package tpcli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// reverseHistorySearch is the state of a bash-style reverse incremental search (^r) through the command history.
+type reverseHistorySearch struct {
+	query                        string
+	match                        string
+	lastSearchFailed             bool
+	commandTextBeforeSearchBegan string
+}
+
+func (panel *commandInputPanel) IsSearchingHistory() bool {
+	return panel.activeReverseSearch != nil
+}
+
+func (panel *commandInputPanel) beginReverseHistorySearch() {
+	panel.activeReverseSearch = &reverseHistorySearch{
+		commandTextBeforeSearchBegan: panel.inputField.GetText(),
+	}
+	panel.userCommandReadlineHistory.ResetIteration()
+	panel.showReverseHistorySearchState()
+}
+
+// handleKeyDuringReverseHistorySearch processes a key event while a reverse search is active.  Printable characters
+// extend the query, ^r searches further back, <enter> accepts the current match into the command input panel, and
+// <esc> or ^g cancels the search, restoring the text that was in the command input panel when the search began.  Any
+// other key accepts the current match, then is processed normally.
+func (panel *commandInputPanel) handleKeyDuringReverseHistorySearch(event *tcell.EventKey) *tcell.EventKey {
+	search := panel.activeReverseSearch
+
+	switch event.Key() {
+	case tcell.KeyRune:
+		if event.Modifiers()&tcell.ModAlt != 0 {
+			panel.endReverseHistorySearch(search.match)
+			return event
+		}
+		search.query += string(event.Rune())
+		if !strings.Contains(search.match, search.query) {
+			panel.searchFurtherBackInHistory()
+		}
+	case tcell.KeyCtrlR:
+		panel.searchFurtherBackInHistory()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if search.query != "" {
+			queryAsRunes := []rune(search.query)
+			search.query = string(queryAsRunes[:len(queryAsRunes)-1])
+			search.match = ""
+			panel.userCommandReadlineHistory.ResetIteration()
+			if search.query != "" {
+				panel.searchFurtherBackInHistory()
+			} else {
+				search.lastSearchFailed = false
+			}
+		}
+	case tcell.KeyEnter:
+		panel.endReverseHistorySearch(search.match)
+		return nil
+	case tcell.KeyEscape, tcell.KeyCtrlG:
+		panel.endReverseHistorySearch(search.commandTextBeforeSearchBegan)
+		return nil
+	default:
+		panel.endReverseHistorySearch(search.match)
+		return event
+	}
+
+	panel.showReverseHistorySearchState()
+	return nil
+}
+
+func (panel *commandInputPanel) searchFurtherBackInHistory() {
+	search := panel.activeReverseSearch
+
+	if match, found := panel.userCommandReadlineHistory.SearchUp(search.query); found {
+		search.match = match
+		search.lastSearchFailed = false
+	} else {
+		search.lastSearchFailed = true
+	}
+}
+
+func (panel *commandInputPanel) showReverseHistorySearchState() {
+	search := panel.activeReverseSearch
+
+	labelFormat := "(reverse-i-search)'%s': "
+	if search.lastSearchFailed {
+		labelFormat = "(failed reverse-i-search)'%s': "
+	}
+
+	panel.inputField.SetLabel(fmt.Sprintf(labelFormat, tview.Escape(search.query)))
+	panel.inputField.SetText(search.match)
+}
+
+func (panel *commandInputPanel) endReverseHistorySearch(resultingCommandText string) {
+	panel.activeReverseSearch = nil
+	panel.inputField.SetLabel(panel.labelForCurrentEditingState())
+	panel.inputField.SetText(resultingCommandText)
+	panel.userCommandReadlineHistory.ResetIteration()
+}
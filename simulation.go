@@ -0,0 +1,138 @@
+package tpcli
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// UsingSimulationScreenOfSize instructs the Tpcli to draw the UI on a tcell.SimulationScreen with the
+// provided dimensions rather than on the real terminal.  This allows the UI to run headless (e.g., in
+// a go test).  Key events can be injected using SimulateKeyPress and SimulateTypingOf, and what each panel
+// shows can be read back using the RenderedTextOf methods.  This must be invoked before Start().
+func (ui *Tpcli) UsingSimulationScreenOfSize(columns int, rows int) *Tpcli {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	screen.Init()
+	screen.SetSize(columns, rows)
+
+	ui.simulationScreen = screen
+	ui.simulationMarker = tcell.NewEventKey(tcell.KeyRune, 0, tcell.ModNone)
+	ui.simulationMarkerProcessed = make(chan struct{}, 1)
+	return ui
+}
+
+// SimulateKeyPress delivers a key event to the UI as if the user had pressed the key.  'key' is the
+// tcell key code, 'r' is the rune (which is meaningful only when key is tcell.KeyRune) and 'modifiers'
+// are any modifier keys held at the time.  This method returns only after the UI has fully processed the
+// event.  The UI must be started with a simulation screen (see UsingSimulationScreenOfSize).
+func (ui *Tpcli) SimulateKeyPress(key tcell.Key, r rune, modifiers tcell.ModMask) {
+	ui.tviewApplication.QueueEvent(tcell.NewEventKey(key, r, modifiers))
+	ui.waitUntilSimulatedEventsAreProcessed()
+}
+
+// SimulateTypingOf delivers each rune in the text to the UI as if the user had typed it.  It does not
+// deliver a final <enter>.  Like SimulateKeyPress, this method returns only after the UI has fully processed
+// the events.
+func (ui *Tpcli) SimulateTypingOf(text string) {
+	for _, r := range text {
+		ui.tviewApplication.QueueEvent(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	ui.waitUntilSimulatedEventsAreProcessed()
+}
+
+// SimulateResizeTo changes the size of the simulation screen, and delivers a resize event to the UI as if the
+// terminal had been resized.  Like SimulateKeyPress, this method returns only after the UI has processed the event.
+func (ui *Tpcli) SimulateResizeTo(columns int, rows int) {
+	ui.simulationScreen.SetSize(columns, rows)
+	ui.tviewApplication.QueueEvent(tcell.NewEventResize(columns, rows))
+	ui.waitUntilSimulatedEventsAreProcessed()
+}
+
+// RenderedTextOfGeneralOutputPanel returns the text currently drawn inside the borders of the general output
+// panel, one string per screen row, with trailing spaces removed.  Text written to the output panels is shown
+// first, even if a redraw is not yet due.  The UI must be started with a simulation screen (see
+// UsingSimulationScreenOfSize).
+func (ui *Tpcli) RenderedTextOfGeneralOutputPanel() []string {
+	return ui.renderedTextOf(ui.generalOutputPanel.textView)
+}
+
+// RenderedTextOfErrorOrHistoryPanel returns the text currently drawn inside the borders of the error (or command
+// history) panel in the same way as RenderedTextOfGeneralOutputPanel.
+func (ui *Tpcli) RenderedTextOfErrorOrHistoryPanel() []string {
+	return ui.renderedTextOf(ui.errorOrHistoryPanel.textView)
+}
+
+// RenderedTextOfCommandPanel returns the text currently drawn in the command input panel, including the prompt,
+// in the same way as RenderedTextOfGeneralOutputPanel.
+func (ui *Tpcli) RenderedTextOfCommandPanel() []string {
+	return ui.renderedTextOf(ui.commandInputPanel.inputField)
+}
+
+func (ui *Tpcli) waitUntilSimulatedEventsAreProcessed() {
+	ui.tviewApplication.QueueEvent(ui.simulationMarker)
+
+	select {
+	case <-ui.simulationMarkerProcessed:
+	case <-ui.uiHasStopped:
+	}
+}
+
+// RenderedTextOfScreen returns the text currently drawn on the entire screen (including anything drawn over the
+// panels, such as the exit confirmation) in the same way as RenderedTextOfGeneralOutputPanel.
+func (ui *Tpcli) RenderedTextOfScreen() []string {
+	return ui.renderedTextOf(entireSimulationScreen{ui.simulationScreen})
+}
+
+// RenderedStyleOfScreenAt returns the style (colors and attributes) of the cell currently drawn at column and row of
+// the screen, counting from zero at the top left.
+func (ui *Tpcli) RenderedStyleOfScreenAt(column int, row int) tcell.Style {
+	var style tcell.Style
+
+	ui.queueUpdateUnlessStopped(func() {
+		ui.addPendingOutputToPanels()
+		ui.tviewApplication.ForceDraw()
+		_, _, style, _ = ui.simulationScreen.GetContent(column, row)
+	})
+
+	return style
+}
+
+type entireSimulationScreen struct {
+	screen tcell.SimulationScreen
+}
+
+func (entire entireSimulationScreen) GetInnerRect() (x int, y int, width int, height int) {
+	width, height = entire.screen.Size()
+	return 0, 0, width, height
+}
+
+type primitiveWithInnerRect interface {
+	GetInnerRect() (x int, y int, width int, height int)
+}
+
+func (ui *Tpcli) renderedTextOf(primitive primitiveWithInnerRect) []string {
+	var renderedRows []string
+
+	ui.queueUpdateUnlessStopped(func() {
+		ui.addPendingOutputToPanels()
+		ui.tviewApplication.ForceDraw()
+
+		cells, screenWidth, screenHeight := ui.simulationScreen.GetContents()
+		x, y, width, height := primitive.GetInnerRect()
+
+		renderedRows = make([]string, 0, height)
+		for row := y; row < y+height && row < screenHeight; row++ {
+			var rowBuilder strings.Builder
+			for column := x; column < x+width && column < screenWidth; column++ {
+				if cellRunes := cells[row*screenWidth+column].Runes; len(cellRunes) > 0 {
+					rowBuilder.WriteString(string(cellRunes))
+				} else {
+					rowBuilder.WriteRune(' ')
+				}
+			}
+			renderedRows = append(renderedRows, strings.TrimRight(rowBuilder.String(), " "))
+		}
+	})
+
+	return renderedRows
+}
@@ -0,0 +1,227 @@
+package tpcli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Theme is the set of colors and styles used by the Tpcli.  A Theme is provided to UsingTheme.  The built-in themes
+// are returned by DarkTheme (the default), LightTheme and HighContrastTheme; each returns a new Theme, which may be
+// changed before it is used.
+type Theme struct {
+	// PanelBackground is the background of every panel.
+	PanelBackground tcell.Color
+
+	// Text is the color of output panel text that has no other style.
+	Text tcell.Color
+
+	// Border and Title are the colors of the borders and titles of the output panels.
+	Border tcell.Color
+	Title  tcell.Color
+
+	// FocusedBorder and FocusedTitle are the colors of the border and title of the output panel with focus.
+	FocusedBorder tcell.Color
+	FocusedTitle  tcell.Color
+
+	// Prompt is the color of the command prompt.  Color tags in the prompt take precedence.
+	Prompt tcell.Color
+
+	// CommandText and CommandBackground are the colors of the text entered in the command panel.
+	CommandText       tcell.Color
+	CommandBackground tcell.Color
+
+	// Hint is the color of argument hints in the command panel.
+	Hint tcell.Color
+
+	// DialogBackground, DialogText, ButtonBackground and ButtonText are the colors of the exit confirmation.
+	DialogBackground tcell.Color
+	DialogText       tcell.Color
+	ButtonBackground tcell.Color
+	ButtonText       tcell.Color
+
+	// FindMatch is the style of matches in an output panel in find mode.
+	FindMatch tcell.Style
+
+	// LevelStyles are the styles of leveled output.  A level that is not in the map is shown in the default style.
+	LevelStyles map[OutputLevel]tcell.Style
+}
+
+// DarkTheme returns the default theme: white text on a black background, as in earlier versions of the Tpcli.
+func DarkTheme() *Theme {
+	return &Theme{
+		PanelBackground:   tcell.ColorBlack,
+		Text:              tcell.ColorWhite,
+		Border:            tcell.ColorWhite,
+		Title:             tcell.ColorWhite,
+		FocusedBorder:     tcell.ColorWhite,
+		FocusedTitle:      tcell.ColorWhite,
+		Prompt:            tcell.ColorYellow,
+		CommandText:       tcell.ColorWhite,
+		CommandBackground: tcell.ColorBlack,
+		Hint:              tcell.ColorGray,
+		DialogBackground:  tcell.ColorBlue,
+		DialogText:        tcell.ColorWhite,
+		ButtonBackground:  tcell.ColorBlack,
+		ButtonText:        tcell.ColorWhite,
+		FindMatch:         tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow),
+		LevelStyles:       defaultOutputLevelStyles(),
+	}
+}
+
+// LightTheme returns a theme with black text on a white background, for terminals with a light background.
+func LightTheme() *Theme {
+	return &Theme{
+		PanelBackground:   tcell.ColorWhite,
+		Text:              tcell.ColorBlack,
+		Border:            tcell.ColorGray,
+		Title:             tcell.ColorBlack,
+		FocusedBorder:     tcell.ColorNavy,
+		FocusedTitle:      tcell.ColorNavy,
+		Prompt:            tcell.ColorNavy,
+		CommandText:       tcell.ColorBlack,
+		CommandBackground: tcell.ColorWhiteSmoke,
+		Hint:              tcell.ColorGray,
+		DialogBackground:  tcell.ColorLightSteelBlue,
+		DialogText:        tcell.ColorBlack,
+		ButtonBackground:  tcell.ColorNavy,
+		ButtonText:        tcell.ColorWhite,
+		FindMatch:         tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow),
+		LevelStyles: map[OutputLevel]tcell.Style{
+			DebugLevel:   tcell.StyleDefault.Foreground(tcell.ColorGray),
+			InfoLevel:    tcell.StyleDefault,
+			SuccessLevel: tcell.StyleDefault.Foreground(tcell.ColorGreen),
+			WarnLevel:    tcell.StyleDefault.Foreground(tcell.ColorDarkOrange),
+			ErrorLevel:   tcell.StyleDefault.Foreground(tcell.ColorMaroon).Bold(true),
+		},
+	}
+}
+
+// HighContrastTheme returns a theme that uses only black, white and the brightest colors, with a yellow highlight
+// for the panel with focus.
+func HighContrastTheme() *Theme {
+	return &Theme{
+		PanelBackground:   tcell.ColorBlack,
+		Text:              tcell.ColorWhite,
+		Border:            tcell.ColorWhite,
+		Title:             tcell.ColorWhite,
+		FocusedBorder:     tcell.ColorYellow,
+		FocusedTitle:      tcell.ColorYellow,
+		Prompt:            tcell.ColorYellow,
+		CommandText:       tcell.ColorWhite,
+		CommandBackground: tcell.ColorBlack,
+		Hint:              tcell.ColorAqua,
+		DialogBackground:  tcell.ColorBlack,
+		DialogText:        tcell.ColorWhite,
+		ButtonBackground:  tcell.ColorYellow,
+		ButtonText:        tcell.ColorBlack,
+		FindMatch:         tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorAqua),
+		LevelStyles: map[OutputLevel]tcell.Style{
+			DebugLevel:   tcell.StyleDefault.Foreground(tcell.ColorSilver),
+			InfoLevel:    tcell.StyleDefault,
+			SuccessLevel: tcell.StyleDefault.Foreground(tcell.ColorLime).Bold(true),
+			WarnLevel:    tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true),
+			ErrorLevel:   tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorRed).Bold(true),
+		},
+	}
+}
+
+// ThemeNamed returns the built-in theme with the provided name: "dark", "light" or "high-contrast".  If there is no
+// such theme, an error is returned.
+func ThemeNamed(name string) (*Theme, error) {
+	switch name {
+	case "dark":
+		return DarkTheme(), nil
+	case "light":
+		return LightTheme(), nil
+	case "high-contrast":
+		return HighContrastTheme(), nil
+	}
+
+	return nil, fmt.Errorf("(%s) is not a built-in theme", name)
+}
+
+// UsingTheme sets the colors and styles used by the Tpcli.  The theme's level styles replace any set earlier by
+// StylingOutputLevelUsing (which may be invoked afterward to change them).  This must be invoked before Start().
+func (ui *Tpcli) UsingTheme(theme *Theme) *Tpcli {
+	ui.theme = theme
+
+	ui.outputLevelStyles = make(map[OutputLevel]tcell.Style)
+	for level, style := range theme.LevelStyles {
+		ui.outputLevelStyles[level] = style
+	}
+
+	return ui
+}
+
+// ApplyTheme sets the panel's colors.  The border and title colors are those of a panel without focus, until
+// ShowFocus is invoked.
+func (panel *outputPanel) ApplyTheme(theme *Theme) *outputPanel {
+	panel.theme = theme
+	panel.findMatchColorTags = tviewColorTagFor(theme.FindMatch)
+
+	panel.textView.SetTextColor(theme.Text)
+	panel.textView.
+		SetBackgroundColor(theme.PanelBackground).
+		SetBorderColor(theme.Border).
+		SetTitleColor(theme.Title)
+
+	return panel
+}
+
+// withPanelBackgroundInColorTags returns text with the default background ("-") in its color tags replaced by the
+// panel's background, because tview draws the default background in the terminal's background color rather than in
+// the panel's.
+func (panel *outputPanel) withPanelBackgroundInColorTags(text string) string {
+	panelBackground := tviewColorNameFor(panel.theme.PanelBackground)
+	if panelBackground == "-" {
+		return text
+	}
+
+	return tviewColorTagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		parts := strings.Split(tag[1:len(tag)-1], ":")
+		if len(parts) < 2 || parts[1] != "-" {
+			return tag
+		}
+		parts[1] = panelBackground
+		return "[" + strings.Join(parts, ":") + "]"
+	})
+}
+
+// ShowFocus sets the panel's border and title colors to those for a panel with (or without) focus.
+func (panel *outputPanel) ShowFocus(hasFocus bool) {
+	if hasFocus {
+		panel.textView.SetBorderColor(panel.theme.FocusedBorder).SetTitleColor(panel.theme.FocusedTitle)
+	} else {
+		panel.textView.SetBorderColor(panel.theme.Border).SetTitleColor(panel.theme.Title)
+	}
+}
+
+// ApplyTheme sets the colors of the command panel.
+func (panel *commandInputPanel) ApplyTheme(theme *Theme) *commandInputPanel {
+	panel.inputField.
+		SetLabelColor(theme.Prompt).
+		SetFieldTextColor(theme.CommandText).
+		SetFieldBackgroundColor(theme.CommandBackground).
+		SetHintTextColor(theme.Hint).
+		SetBackgroundColor(theme.PanelBackground)
+	return panel
+}
+
+// applyThemeToModal sets the colors of a dialog, like the exit confirmation.
+func (ui *Tpcli) applyThemeToModal(modal *tview.Modal) {
+	modal.
+		SetBackgroundColor(ui.theme.DialogBackground).
+		SetTextColor(ui.theme.DialogText).
+		SetButtonBackgroundColor(ui.theme.ButtonBackground).
+		SetButtonTextColor(ui.theme.ButtonText)
+}
+
+// highlightOutputPanelWithFocus is invoked before each draw, so that the colors of the output panels show which of
+// them (if either) has focus.
+func (ui *Tpcli) highlightOutputPanelWithFocus() {
+	ui.generalOutputPanel.ShowFocus(ui.generalOutputPanel.textView.HasFocus())
+	ui.errorOrHistoryPanel.ShowFocus(ui.errorOrHistoryPanel.textView.HasFocus())
+}
@@ -1,16 +1,21 @@
 package tpcli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 // StackingOrder represents the order in which the three panels should be arranged vertically.
-// All panels consume all horizontal space (i.e., they all use the same number of columns).
+// All panels consume all horizontal space (i.e., they all use the same number of columns).  For
+// other arrangements, including panels side by side, see Layout.
 type StackingOrder int
 
 // Various stacking orders.  "Command" is the command input panel.  "General" is the general
@@ -24,6 +29,17 @@ const (
 	ErrorGeneralCommand
 )
 
+// Panel identifies one of the three panels.
+type Panel int
+
+// The panels.  ErrorOrHistoryPanel is the error panel, or the command history panel if UsingCommandHistoryPanel is
+// invoked.
+const (
+	CommandPanel Panel = iota
+	GeneralOutputPanel
+	ErrorOrHistoryPanel
+)
+
 type panelTypes int
 
 const (
@@ -39,29 +55,95 @@ const (
 // panel supports basic shell-emacs bindings (e.g., ^a to go to the start of the
 // line, ^e to the end of the line) and arrow key readline-style history navigation.
 type Tpcli struct {
-	tviewApplication              *tview.Application
-	commandInputPanel             *commandInputPanel
-	generalOutputPanel            *outputPanel
-	errorOrHistoryPanel           *outputPanel
-	userInputStringChannel        chan string
-	panelTypesInOrder             []panelTypes
-	indexInOrderOfPanelWithFocus  int
-	useErrorPanelAsCommandHistory bool
-	functionToExecuteAfterUIExits func()
+	tviewApplication                   *tview.Application
+	commandInputPanel                  *commandInputPanel
+	generalOutputPanel                 *outputPanel
+	errorOrHistoryPanel                *outputPanel
+	userInputStringChannel             chan string
+	commandsToDeliver                  *orderedDeliveryQueue // nil until entered commands are delivered
+	commandDeliveryMutex               sync.Mutex
+	enteredCommandsAreRequested        bool
+	commandDeliveryHasStarted          bool
+	commandDeliveryHasEnded            bool
+	panelTypesInOrder                  []panelTypes
+	indexInOrderOfPanelWithFocus       int
+	useErrorPanelAsCommandHistory      bool
+	functionToExecuteAfterUIExits      func()
+	functionToExecuteAfterUIExitsIsSet bool
+	commandCompleter                   Completer
+	commandHinter                      ArgumentHinter
+	commandHistorySize                 uint
+	commandHistoryFilePath             string
+	usePrefixFilteredHistoryNavigation bool
+	commandHistoryControl              HistoryControl
+	commandPatternsIgnoredByHistory    []*regexp.Regexp
+	multiLineCommandIsComplete         func(commandText string) bool
+	useViEditingMode                   bool
+	commandPrompt                      string
+	commandPromptProvider              func() string
+	layout                             *Layout
+	layoutFlexes                       map[*Layout]*tview.Flex
+	uiPages                            *tview.Pages
+	panelSizes                         map[Panel]PanelSize
+	linesInCommand                     int
+	maximizedPanel                     *outputPanel // nil unless a panel is maximized
+	maximizedPanelGrid                 *tview.Grid
+	exitCommands                       []string
+	exitKeys                           []tcell.Key
+	confirmBeforeExiting               bool
+	keyBindings                        []*keyBinding
+	pendingChordStrokes                []keyStroke
+	interruptKeys                      []tcell.Key
+	eventChannel                       chan *Event
+	eventsToDeliver                    *orderedDeliveryQueue
+	runningUnderContext                bool
+	lastDrawnScreenColumns             int
+	lastDrawnScreenRows                int
+	pendingOutput                      []pendingOutput
+	pendingCommandString               *string // set by ReplaceCommandStringWith until applied in the UI goroutine
+	pendingPrompt                      *string // set by ChangePromptTo until applied in the UI goroutine
+	promptRefreshIsPending             bool    // set by RefreshPrompt until applied in the UI goroutine
+	pendingOutputMutex                 sync.Mutex
+	outputRedrawsHaveStarted           bool
+	outputRedrawIsScheduled            bool
+	lastOutputRedraw                   time.Time
+	minimumTimeBetweenOutputRedraws    time.Duration
+	outputPanelSettings                map[Panel]*outputPanelSettings
+	simulationScreen                   tcell.SimulationScreen
+	simulationMarker                   *tcell.EventKey
+	simulationMarkerProcessed          chan struct{}
+	outputLevelStyles                  map[OutputLevel]tcell.Style
+	theme                              *Theme
+	uiHasStopped                       chan struct{}
+	errorFromTviewApplication          error
+	stopTviewApplicationOnce           sync.Once
 }
 
 // NewUI constructs the UI interface elements for the Tpcli but does not start showing
 // them (that happens on invocation of Start())
 func NewUI() *Tpcli {
 	ui := &Tpcli{
-		userInputStringChannel:        make(chan string, 10),
-		panelTypesInOrder:             []panelTypes{generalOutputPanel, errorOrHistoryPanel, commandPanel},
-		indexInOrderOfPanelWithFocus:  2,
-		functionToExecuteAfterUIExits: func() { os.Exit(0) },
-		useErrorPanelAsCommandHistory: false,
+		userInputStringChannel:          make(chan string),
+		functionToExecuteAfterUIExits:   func() { os.Exit(0) },
+		useErrorPanelAsCommandHistory:   false,
+		commandHistorySize:              200,
+		commandHistoryFilePath:          "",
+		commandPrompt:                   "Enter command>",
+		exitCommands:                    []string{"quit", "exit"},
+		exitKeys:                        []tcell.Key{tcell.KeyEscape, tcell.KeyCtrlQ},
+		interruptKeys:                   []tcell.Key{tcell.KeyCtrlC},
+		minimumTimeBetweenOutputRedraws: time.Second / defaultMaximumRedrawsPerSecond,
+		outputPanelSettings: map[Panel]*outputPanelSettings{
+			GeneralOutputPanel:  {},
+			ErrorOrHistoryPanel: {},
+		},
+		panelSizes:        defaultPanelSizes(),
+		outputLevelStyles: defaultOutputLevelStyles(),
+		theme:             DarkTheme(),
+		uiHasStopped:      make(chan struct{}),
 	}
 
-	return ui
+	return ui.UsingLayout(stackOf(GeneralOutputPanel, ErrorOrHistoryPanel, CommandPanel))
 }
 
 // Write allows an instance of tpcli to be used as a Writer.  Any bytes provided will be interpreted
@@ -71,37 +153,40 @@ func (ui *Tpcli) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// ChangeStackingOrderTo changes the panel stacking order to the provided ordering
+// ChangeStackingOrderTo changes the panel stacking order to the provided ordering.  This is the same as
+// UsingLayout with the panels stacked vertically in that order.
 func (ui *Tpcli) ChangeStackingOrderTo(newOrder StackingOrder) *Tpcli {
 	switch newOrder {
 	case CommandErrorGeneral:
-		ui.panelTypesInOrder = []panelTypes{commandPanel, errorOrHistoryPanel, generalOutputPanel}
+		return ui.UsingLayout(stackOf(CommandPanel, ErrorOrHistoryPanel, GeneralOutputPanel))
 	case CommandGeneralError:
-		ui.panelTypesInOrder = []panelTypes{commandPanel, generalOutputPanel, errorOrHistoryPanel}
+		return ui.UsingLayout(stackOf(CommandPanel, GeneralOutputPanel, ErrorOrHistoryPanel))
 	case GeneralCommandError:
-		ui.panelTypesInOrder = []panelTypes{generalOutputPanel, commandPanel, errorOrHistoryPanel}
+		return ui.UsingLayout(stackOf(GeneralOutputPanel, CommandPanel, ErrorOrHistoryPanel))
 	case GeneralErrorCommand:
-		ui.panelTypesInOrder = []panelTypes{generalOutputPanel, errorOrHistoryPanel, commandPanel}
+		return ui.UsingLayout(stackOf(GeneralOutputPanel, ErrorOrHistoryPanel, CommandPanel))
 	case ErrorCommandGeneral:
-		ui.panelTypesInOrder = []panelTypes{errorOrHistoryPanel, commandPanel, generalOutputPanel}
+		return ui.UsingLayout(stackOf(ErrorOrHistoryPanel, CommandPanel, GeneralOutputPanel))
 	case ErrorGeneralCommand:
-		ui.panelTypesInOrder = []panelTypes{errorOrHistoryPanel, generalOutputPanel, commandPanel}
-	}
-
-	for i, panelType := range ui.panelTypesInOrder {
-		if panelType == commandPanel {
-			ui.indexInOrderOfPanelWithFocus = i
-			break
-		}
+		return ui.UsingLayout(stackOf(ErrorOrHistoryPanel, GeneralOutputPanel, CommandPanel))
 	}
 
 	return ui
 }
 
+func stackOf(panels ...Panel) *Layout {
+	layout := PanelsStackedVertically()
+	for _, panel := range panels {
+		layout.elements = append(layout.elements, LayoutOfPanel(panel))
+	}
+	return layout
+}
+
 // OnUIExit provides a function that is executed by the Tpcli immediately after it Stops, and the
 // UI is terminated.  This function is executed when a UI exit is provided, including ^q or <esc>.
 func (ui *Tpcli) OnUIExit(functionToExecuteAfterUIExits func()) *Tpcli {
 	ui.functionToExecuteAfterUIExits = functionToExecuteAfterUIExits
+	ui.functionToExecuteAfterUIExitsIsSet = true
 	return ui
 }
 
@@ -114,49 +199,344 @@ func (ui *Tpcli) UsingCommandHistoryPanel() *Tpcli {
 	return ui
 }
 
+// LimitingCommandHistoryTo sets the maximum number of entered commands that are retained in the command history
+// (which can be navigated using the arrow keys).  The default is 200.  If maximumEntries is 0, this method panics.
+func (ui *Tpcli) LimitingCommandHistoryTo(maximumEntries uint) *Tpcli {
+	if maximumEntries == 0 {
+		panic("LimitingCommandHistoryTo invoked with a maximum of 0 entries")
+	}
+
+	ui.commandHistorySize = maximumEntries
+	return ui
+}
+
+// UsingCommandHistoryFile instructs the Tpcli to load the command history from the file at filePath when it Starts,
+// and to append each entered command to that file, so that the history persists between sessions.  The file is
+// trimmed to the maximum command history size (see LimitingCommandHistoryTo).  If the file cannot be read or written,
+// the error is written to the error output panel.  See ReadlineHistory.PersistToFile for the file format.
+func (ui *Tpcli) UsingCommandHistoryFile(filePath string) *Tpcli {
+	ui.commandHistoryFilePath = filePath
+	return ui
+}
+
+// UsingPrefixFilteredHistoryNavigation changes the behavior of the up and down arrow keys in the command input panel.
+// Normally, they move through every entry in the command history.  When this is set, and there is text in the command
+// input panel when the up arrow is first pressed, they move only through entries that start with that text (as with
+// zsh's history-beginning-search).  Moving down past the most recent matching entry restores the original text.
+func (ui *Tpcli) UsingPrefixFilteredHistoryNavigation() *Tpcli {
+	ui.usePrefixFilteredHistoryNavigation = true
+	return ui
+}
+
+// LimitingPanelLinesTo sets the maximum number of lines retained by an output panel (either GeneralOutputPanel or
+// ErrorOrHistoryPanel).  When more lines are added, the oldest are dropped.  Lines are counted as they are shown, so
+// a line that is wrapped counts as more than one line.  By default, the panels retain every line, which may use a lot
+// of memory in a long-running session.  If panel is CommandPanel, this method panics.  This must be invoked before
+// Start().
+func (ui *Tpcli) LimitingPanelLinesTo(panel Panel, maximumLines uint) *Tpcli {
+	ui.settingsForOutputPanel(panel, "LimitingPanelLinesTo").maximumLines = maximumLines
+	return ui
+}
+
+// outputPanelSettings are the settings for an output panel, which are applied when the panel is created by Start().
+type outputPanelSettings struct {
+	maximumLines    uint
+	timestampLayout string
+	showSourceTags  bool
+	translateANSI   bool
+	minimumLevel    OutputLevel
+}
+
+// settingsForOutputPanel returns the settings for an output panel.  If panel is not an output panel, it panics,
+// naming the method that was invoked.
+func (ui *Tpcli) settingsForOutputPanel(panel Panel, methodName string) *outputPanelSettings {
+	settings, isAnOutputPanel := ui.outputPanelSettings[panel]
+	if !isAnOutputPanel {
+		panic(fmt.Sprintf("%s invoked for a panel that is not an output panel", methodName))
+	}
+	return settings
+}
+
+// ControllingCommandHistoryWith sets the policies that determine which entered commands are retained in the command
+// history (e.g., IgnoreConsecutiveDuplicates | IgnoreItemsStartingWithSpace).  See HistoryControl.  By default, every
+// non-empty command is retained.
+func (ui *Tpcli) ControllingCommandHistoryWith(control HistoryControl) *Tpcli {
+	ui.commandHistoryControl = control
+	return ui
+}
+
+// IgnoringCommandsInHistoryMatching keeps entered commands that match the pattern out of the command history (and
+// the command history file), which is useful for commands that contain passwords.  The command is still delivered
+// as usual.  'pattern' may be either a string or a *regexp.Regexp.  If it is a string, then it is fed to
+// regexp.MustCompile (and will panic if the compilation fails).  If it is neither type, this method panics.  This may
+// be invoked more than once.
+func (ui *Tpcli) IgnoringCommandsInHistoryMatching(pattern interface{}) *Tpcli {
+	ui.commandPatternsIgnoredByHistory = append(ui.commandPatternsIgnoredByHistory, regexpFromStringOrRegexp(pattern, "IgnoringCommandsInHistoryMatching"))
+	return ui
+}
+
+// UsingMultiLineCommandInput allows commands to span more than one line.  When <enter> is pressed in the command
+// input panel, commandIsComplete is called with the command text.  If it returns true, the command is delivered as
+// usual (including any newlines it contains).  Otherwise, a newline is inserted at the cursor, and the command panel
+// grows to show each line (up to a limit).  The up and down arrows move between lines, and move through the command
+// history only from the first or last line.  CommandHasBalancedBrackets and CommandHasNoTrailingBackslash may be used
+// as commandIsComplete, or combined in a caller-supplied function.
+func (ui *Tpcli) UsingMultiLineCommandInput(commandIsComplete func(commandText string) bool) *Tpcli {
+	ui.multiLineCommandIsComplete = commandIsComplete
+	return ui
+}
+
 // Start instructs Tpcli to draw the UI and start handling keyboard events.  This should
 // be invoked as a goroutine.
 func (ui *Tpcli) Start() {
 	ui.createTviewApplication().
 		createPanelForErrorOrCommandHistory().
-		createCommandInputPanel().
 		createGeneralOutputPanel().
-		composeIntoUIGridUsingStackOrder(ui.panelTypesInOrder).
+		createCommandInputPanel().
+		composeIntoLayout().
 		addGlobalKeybindings()
 
-	go ui.tviewApplication.Run()
+	ui.commandDeliveryMutex.Lock()
+	ui.commandDeliveryHasStarted = true
+	if ui.eventChannel == nil || ui.enteredCommandsAreRequested {
+		ui.startDeliveringEnteredCommands()
+	}
+	ui.commandDeliveryMutex.Unlock()
+
+	ui.tviewApplication.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		ui.highlightOutputPanelWithFocus()
+		ui.emitEventIfScreenWasResized(screen)
+		return false
+	})
+
+	if ui.eventChannel != nil {
+		ui.eventsToDeliver = newOrderedDeliveryQueue()
+		go ui.relayEventsToChannelOfEvents()
+	}
+
+	go func() {
+		ui.errorFromTviewApplication = ui.tviewApplication.Run()
+		ui.endDeliveryOfEnteredCommands()
+		if ui.eventsToDeliver != nil {
+			ui.eventsToDeliver.Close()
+		}
+		close(ui.uiHasStopped)
+	}()
+
+	ui.startOutputRedraws()
+}
+
+// Run draws the UI and handles keyboard events, as Start does, but blocks until the UI stops (because the user
+// exits, or Stop is invoked) or ctx is cancelled, in which case the UI is stopped.  The terminal is restored before
+// Run returns.  Run returns an error if the terminal could not be initialized.  When Run is used, the default function
+// executed after the UI exits (which exits the process) is not executed, so that the application may shut down
+// gracefully after Run returns (a function provided to OnUIExit is still executed).  After the UI stops, the
+// ChannelOfEnteredCommands (and the ChannelOfEvents, if it is used) is closed once the commands entered before the
+// UI stopped have been read.
+func (ui *Tpcli) Run(ctx context.Context) error {
+	ui.runningUnderContext = true
+	ui.Start()
+
+	select {
+	case <-ui.uiHasStopped:
+	case <-ctx.Done():
+		ui.Stop()
+		<-ui.uiHasStopped
+	}
+
+	return ui.errorFromTviewApplication
+}
+
+// startDeliveringEnteredCommands creates the queue of commands to deliver on the ChannelOfEnteredCommands, and the
+// goroutine relaying them to it, if they do not exist.  commandDeliveryMutex must be held.
+func (ui *Tpcli) startDeliveringEnteredCommands() {
+	if ui.commandsToDeliver != nil {
+		return
+	}
+
+	ui.commandsToDeliver = newOrderedDeliveryQueue()
+	go ui.relayCommandsToChannelOfEnteredCommands(ui.commandsToDeliver)
+
+	if ui.commandDeliveryHasEnded {
+		ui.commandsToDeliver.Close()
+	}
+}
+
+func (ui *Tpcli) endDeliveryOfEnteredCommands() {
+	ui.commandDeliveryMutex.Lock()
+	defer ui.commandDeliveryMutex.Unlock()
+
+	ui.commandDeliveryHasEnded = true
+	if ui.commandsToDeliver != nil {
+		ui.commandsToDeliver.Close()
+	}
+}
+
+// deliverEnteredCommand queues command for the ChannelOfEnteredCommands, unless commands are not being delivered on
+// it (see ChannelOfEvents).
+func (ui *Tpcli) deliverEnteredCommand(command string) {
+	ui.commandDeliveryMutex.Lock()
+	defer ui.commandDeliveryMutex.Unlock()
+
+	if ui.commandsToDeliver != nil {
+		ui.commandsToDeliver.Add(command)
+	}
+}
+
+func (ui *Tpcli) relayCommandsToChannelOfEnteredCommands(commandsToDeliver *orderedDeliveryQueue) {
+	for command := range commandsToDeliver.out {
+		ui.userInputStringChannel <- command.(string)
+	}
+	close(ui.userInputStringChannel)
 }
 
 func (ui *Tpcli) exit() {
 	ui.Stop()
-	ui.functionToExecuteAfterUIExits()
+	ui.emitEvent(&Event{Type: ExitRequested})
+	if ui.functionToExecuteAfterUIExitsIsSet || (ui.eventChannel == nil && !ui.runningUnderContext) {
+		ui.functionToExecuteAfterUIExits()
+	}
 }
 
 // Stop instructs Tpcli to stop the UI, clearing it.  This is not the same as an exit
 // triggered by ^q or <esc>.  This only stops the UI.  It does not exit the function provided
-// by OnUIExit.
+// by OnUIExit.  Stop has no effect if the UI has not been started or has already
+// stopped.
 func (ui *Tpcli) Stop() {
-	ui.tviewApplication.Stop()
+	if ui.tviewApplication == nil {
+		return
+	}
+
+	select {
+	case <-ui.uiHasStopped:
+		return
+	default:
+	}
+
+	// tview clears its screen without holding its lock as Run() returns, so a second Stop() would race with it
+	ui.stopTviewApplicationOnce.Do(ui.tviewApplication.Stop)
 }
 
 // ChannelOfEnteredCommands is a channel that emits the commands that the user enters in the
 // command panel. A command is a string of UTF-8 text that ends with a newline (signaled by
-// the <enter> key).  The commands strings sent on this channel omit the trailing newline.
+// the <enter> key).  The commands strings sent on this channel omit the trailing newline.  Commands
+// are sent in the order in which they are entered, and the channel is closed after the UI stops,
+// once the last command has been read.  If the ChannelOfEvents is used, commands are sent on this
+// channel only once this method has been invoked, so that commands are not retained for a channel
+// that is never read.
 func (ui *Tpcli) ChannelOfEnteredCommands() <-chan string {
+	ui.commandDeliveryMutex.Lock()
+	defer ui.commandDeliveryMutex.Unlock()
+
+	ui.enteredCommandsAreRequested = true
+	if ui.commandDeliveryHasStarted {
+		ui.startDeliveringEnteredCommands()
+	}
+
 	return ui.userInputStringChannel
 }
 
+// ChangePromptTo sets the prompt shown before the command text in the command panel.  A space is added after the
+// prompt.  The prompt may include tview color tags (e.g., "[green]connected[white]>"), so square brackets that are
+// meant literally may need to be escaped using tview.Escape().  This may be invoked before Start(), or at any time
+// afterward from any goroutine, including the UI goroutine (e.g., from a key binding callback).  After Start(), it
+// does not wait for the prompt to change: the prompt is changed on the next redraw.
+func (ui *Tpcli) ChangePromptTo(promptWithoutTrailingSpace string) *Tpcli {
+	if ui.tviewApplication == nil {
+		ui.commandPrompt = promptWithoutTrailingSpace
+		return ui
+	}
+
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.pendingPrompt = &promptWithoutTrailingSpace
+	ui.promptRefreshIsPending = false
+	ui.scheduleOutputRedrawIfNeeded()
+
+	return ui
+}
+
+// UsingPromptProvider sets a function which supplies the prompt (see ChangePromptTo).  It is invoked when the UI
+// starts, and again each time a command is entered, so that the prompt can reflect application state.  Because an
+// entered command is delivered on a channel, the application may not have acted on it when the provider is invoked,
+// so RefreshPrompt should be used after the application state changes.  The provider is invoked from the UI
+// goroutine.
+func (ui *Tpcli) UsingPromptProvider(provider func() string) *Tpcli {
+	ui.commandPromptProvider = provider
+	return ui
+}
+
+// RefreshPrompt invokes the prompt provider (see UsingPromptProvider) and shows the resulting prompt.  It may be
+// invoked from any goroutine, including the UI goroutine, after Start().  It does not wait for the prompt to change:
+// the provider is invoked on the next redraw.
+func (ui *Tpcli) RefreshPrompt() {
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.promptRefreshIsPending = true
+	ui.pendingPrompt = nil
+	ui.scheduleOutputRedrawIfNeeded()
+}
+
+// queueUpdateUnlessStopped runs update in the UI goroutine, returning after it is complete, or as soon as the UI
+// stops (in which case update may not run).  tview.Application.QueueUpdate would instead block forever if the UI
+// stopped before running update, so it is invoked from a separate goroutine, which is left waiting in that case.
+// This must not be invoked from the UI goroutine.
+func (ui *Tpcli) queueUpdateUnlessStopped(update func()) {
+	select {
+	case <-ui.uiHasStopped:
+		return
+	default:
+	}
+
+	updateIsComplete := make(chan struct{})
+	go ui.tviewApplication.QueueUpdate(func() {
+		update()
+		close(updateIsComplete)
+	})
+
+	select {
+	case <-updateIsComplete:
+	case <-ui.uiHasStopped:
+	}
+}
+
+// queueUpdateDrawUnlessStopped is the same as queueUpdateUnlessStopped, but the UI is redrawn after update.
+func (ui *Tpcli) queueUpdateDrawUnlessStopped(update func()) {
+	ui.queueUpdateUnlessStopped(func() {
+		update()
+		ui.tviewApplication.ForceDraw()
+	})
+}
+
 // ReplaceCommandStringWith writes the newString to the command panel, replacing whatever
-// is currently there.
+// is currently there.  It may be invoked from any goroutine, including the UI goroutine (e.g.,
+// from a key binding callback), before or after Start().  It does not wait for the command panel
+// to change: the command string is replaced on the next redraw, and before any key pressed
+// afterward is processed.
 func (ui *Tpcli) ReplaceCommandStringWith(newString string) {
-	ui.commandInputPanel.ChangeCommandStringTo(newString)
+	ui.pendingOutputMutex.Lock()
+	defer ui.pendingOutputMutex.Unlock()
+
+	ui.pendingCommandString = &newString
+	ui.scheduleOutputRedrawIfNeeded()
 }
 
 // AddStringToGeneralOutput appends additionalContent to whatever text is currently in the
 // general output panel.  A newline (\n) is appended to the text that is already there first,
-// then the new text is appended.
+// then the new text is appended.  This may be invoked from any goroutine (including before
+// Start()).  It does not wait for the panel to be redrawn; text added between redraws is shown
+// together on the next redraw (see LimitingRedrawsTo).
 func (ui *Tpcli) AddStringToGeneralOutput(additionalContent string) {
-	ui.generalOutputPanel.AppendText(additionalContent)
+	ui.AddStringFromSourceToGeneralOutput("", additionalContent)
+}
+
+// AddStringFromSourceToGeneralOutput is the same as AddStringToGeneralOutput, but the content is
+// attributed to a source (e.g., "peer"), which is shown before each line if ShowingSourceTagsIn
+// is invoked for the panel.
+func (ui *Tpcli) AddStringFromSourceToGeneralOutput(source string, additionalContent string) {
+	ui.addToOutputPanel(generalOutputPanel, source, additionalContent)
 }
 
 // FmtToGeneralOutput is the same as AddStringToGeneralOutput, but it takes fmt.Sprintf
@@ -169,11 +549,22 @@ func (ui *Tpcli) FmtToGeneralOutput(format string, a ...interface{}) {
 // AddStringToGeneralOutput does. However, if UsingCommandHistoryPanel is invoked, then
 // any additionalContent submitted here is instead written to the general output panel.
 func (ui *Tpcli) AddStringToErrorOutput(additionalContent string) {
+	ui.AddStringFromSourceToErrorOutput("", additionalContent)
+}
+
+// AddStringFromSourceToErrorOutput is the same as AddStringToErrorOutput, but the content is
+// attributed to a source, as with AddStringFromSourceToGeneralOutput.
+func (ui *Tpcli) AddStringFromSourceToErrorOutput(source string, additionalContent string) {
+	ui.addToOutputPanel(ui.panelForErrorOutput(), source, additionalContent)
+}
+
+// panelForErrorOutput returns the panel to which error output is written, which is the general output panel if the
+// third panel is the command history panel.
+func (ui *Tpcli) panelForErrorOutput() panelTypes {
 	if ui.useErrorPanelAsCommandHistory {
-		ui.generalOutputPanel.AppendText(additionalContent)
-	} else {
-		ui.errorOrHistoryPanel.AppendText(additionalContent)
+		return generalOutputPanel
 	}
+	return errorOrHistoryPanel
 }
 
 // FmtToErrorOutput is the same as AddStringToErrorOutput, but it takes fmt.Sprintf
@@ -184,106 +575,143 @@ func (ui *Tpcli) FmtToErrorOutput(format string, a ...interface{}) {
 
 func (ui *Tpcli) createTviewApplication() *Tpcli {
 	ui.tviewApplication = tview.NewApplication()
+	if ui.simulationScreen != nil {
+		ui.tviewApplication.SetScreen(ui.simulationScreen)
+	}
 	return ui
 }
 
 func (ui *Tpcli) createCommandInputPanel() *Tpcli {
-	ui.commandInputPanel = newCommandInputPanel(ui.tviewApplication)
+	ui.commandInputPanel = newCommandInputPanel(ui.tviewApplication, ui.createCommandHistory()).ApplyTheme(ui.theme)
+	ui.commandInputPanel.historyNavigationIsPrefixFiltered = ui.usePrefixFilteredHistoryNavigation
+	ui.commandInputPanel.inputField.SetHintFunc(ui.commandHinter)
+	ui.commandInputPanel.ChangePromptTo(ui.commandPrompt)
+	if ui.commandPromptProvider != nil {
+		ui.commandInputPanel.UsePromptProvider(ui.commandPromptProvider)
+	}
+	if ui.useViEditingMode {
+		ui.commandInputPanel.useViEditing()
+	}
+	if ui.multiLineCommandIsComplete != nil {
+		ui.commandInputPanel.commandIsComplete = ui.multiLineCommandIsComplete
+		ui.commandInputPanel.inputField.SetChangedFunc(func(text string) {
+			ui.resizeCommandPanelToFit(strings.Count(text, "\n") + 1)
+		})
+	}
+	if ui.commandCompleter != nil {
+		ui.commandInputPanel.
+			CompleteUsing(ui.commandCompleter).
+			WhenThereAreMultipleCompletionCandidates(func(candidates []string) {
+				ui.AddStringFromSourceToGeneralOutput(uiSource, strings.Join(candidates, "  "))
+			})
+	}
 	if ui.useErrorPanelAsCommandHistory {
 		ui.commandInputPanel.WhenACommandIsEntered(func(command string) {
-			go func() { ui.userInputStringChannel <- command }()
-			ui.errorOrHistoryPanel.AppendText(command)
-			switch command {
-			case "quit":
-				fallthrough
-			case "exit":
-				ui.exit()
+			ui.deliverEnteredCommand(command)
+			ui.emitEvent(&Event{Type: CommandEntered, Command: command})
+			ui.errorOrHistoryPanel.AppendTextFrom("", time.Now(), "", command)
+			if ui.isAnExitCommand(command) {
+				ui.requestExit()
 			}
 		})
 	} else {
 		ui.commandInputPanel.WhenACommandIsEntered(func(command string) {
-			go func() { ui.userInputStringChannel <- command }()
-			switch command {
-			case "quit":
-				fallthrough
-			case "exit":
-				ui.exit()
+			ui.deliverEnteredCommand(command)
+			ui.emitEvent(&Event{Type: CommandEntered, Command: command})
+			if ui.isAnExitCommand(command) {
+				ui.requestExit()
 			}
 		})
 	}
 	return ui
 }
 
+func (ui *Tpcli) createCommandHistory() *ReadlineHistory {
+	history := NewReadlineHistory(ui.commandHistorySize).UsingHistoryControl(ui.commandHistoryControl)
+	for _, pattern := range ui.commandPatternsIgnoredByHistory {
+		history.IgnoringItemsMatching(pattern)
+	}
+
+	if ui.commandHistoryFilePath != "" {
+		history.OnFileError(func(err error) {
+			ui.AddStringFromSourceToErrorOutput(uiSource, fmt.Sprintf("Failed to update command history file (%s): %s", ui.commandHistoryFilePath, err.Error()))
+		})
+
+		if err := history.PersistToFile(ui.commandHistoryFilePath); err != nil {
+			ui.AddStringFromSourceToErrorOutput(uiSource, fmt.Sprintf("Failed to load command history file (%s): %s", ui.commandHistoryFilePath, err.Error()))
+		}
+	}
+
+	return history
+}
+
 func (ui *Tpcli) createGeneralOutputPanel() *Tpcli {
-	ui.generalOutputPanel = newOutputPanel(ui.tviewApplication)
+	ui.generalOutputPanel = newOutputPanel().
+		ApplySettings(ui.outputPanelSettings[GeneralOutputPanel]).
+		ApplyTheme(ui.theme)
 	return ui
 }
 
 func (ui *Tpcli) createPanelForErrorOrCommandHistory() *Tpcli {
-	ui.errorOrHistoryPanel = newOutputPanel(ui.tviewApplication).SetTitleTo("Command History")
+	ui.errorOrHistoryPanel = newOutputPanel().
+		SetTitleTo("Command History").
+		ApplySettings(ui.outputPanelSettings[ErrorOrHistoryPanel]).
+		ApplyTheme(ui.theme)
 	return ui
 }
 
-func (ui *Tpcli) composeIntoUIGridUsingStackOrder(panelOrderByType []panelTypes) *Tpcli {
-	grid := tview.NewGrid()
-
-	rowSizes := make([]int, 3)
-
-	for i, panelType := range panelOrderByType {
-		switch panelType {
-		case generalOutputPanel:
-			rowSizes[i] = 0
-
-		case errorOrHistoryPanel:
-			rowSizes[i] = 12
-
-		case commandPanel:
-			rowSizes[i] = 3
+func (ui *Tpcli) addGlobalKeybindings() *Tpcli {
+	ui.tviewApplication.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event == ui.simulationMarker {
+			ui.simulationMarkerProcessed <- struct{}{}
+			return nil
 		}
-	}
 
-	grid.
-		SetRows(rowSizes...).
-		SetColumns(0)
+		ui.applyPendingCommandPanelChanges()
 
-	// The SetRows() must be completed before laying these out
-	for i, panelType := range panelOrderByType {
-		switch panelType {
-		case generalOutputPanel:
-			grid.AddItem(ui.generalOutputPanel.BackingTviewObject(), i, 0, 1, 1, 0, 0, false)
-		case errorOrHistoryPanel:
-			grid.AddItem(ui.errorOrHistoryPanel.BackingTviewObject(), i, 0, 1, 1, 0, 0, false)
-		case commandPanel:
-			grid.AddItem(ui.commandInputPanel.BackingTviewObject(), i, 0, 1, 1, 0, 0, true)
+		if ui.exitConfirmationIsShown() {
+			return event
 		}
-	}
 
-	ui.tviewApplication.SetRoot(grid, true)
-
-	return ui
-}
+		if ui.dispatchKeyBindings(event) {
+			return nil
+		}
 
-func (ui *Tpcli) addGlobalKeybindings() *Tpcli {
-	ui.tviewApplication.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyTab:
-			ui.indexInOrderOfPanelWithFocus++
-			if ui.indexInOrderOfPanelWithFocus >= len(ui.panelTypesInOrder) {
-				ui.indexInOrderOfPanelWithFocus = 0
-			}
-			switch ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus] {
-			case commandPanel:
-				ui.tviewApplication.SetFocus(ui.commandInputPanel.BackingTviewObject())
-			case generalOutputPanel:
-				ui.tviewApplication.SetFocus(ui.generalOutputPanel.BackingTviewObject())
-			default:
-				ui.tviewApplication.SetFocus(ui.errorOrHistoryPanel.BackingTviewObject())
+			if ui.commandCompleter != nil && ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus] == commandPanel {
+				return event
 			}
+			ui.moveFocusToNextPanel()
+			return nil
+		case tcell.KeyBacktab:
+			ui.moveFocusToPreviousPanel()
 			return nil
 		case tcell.KeyESC:
-			ui.exit()
-		case tcell.KeyCtrlQ:
-			ui.exit()
+			if ui.commandInputPanel.IsSearchingHistory() {
+				return event
+			}
+			if focusedOutputPanel := ui.focusedOutputPanel(); focusedOutputPanel != nil && focusedOutputPanel.IsFinding() {
+				return event
+			}
+			if ui.commandInputPanel.UsesViEditing() && ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus] == commandPanel {
+				return event
+			}
+		}
+
+		if ui.isAnExitKey(event.Key()) {
+			ui.requestExit()
+			return nil
+		}
+
+		if ui.isAnInterruptKey(event.Key()) {
+			ui.interrupt(event.Key())
+			return nil
+		}
+
+		// tview stops the application on ^c, which would bypass the function provided to OnUIExit
+		if event.Key() == tcell.KeyCtrlC {
+			return nil
 		}
 
 		return event
@@ -292,33 +720,142 @@ func (ui *Tpcli) addGlobalKeybindings() *Tpcli {
 	return ui
 }
 
+func (ui *Tpcli) moveFocusToNextPanel() {
+	ui.indexInOrderOfPanelWithFocus++
+	if ui.indexInOrderOfPanelWithFocus >= len(ui.panelTypesInOrder) {
+		ui.indexInOrderOfPanelWithFocus = 0
+	}
+	ui.focusPanelWithFocusIndex()
+	ui.keepFocusedPanelMaximized()
+	ui.emitEvent(&Event{Type: FocusChanged, PanelWithFocus: ui.panelWithFocus()})
+}
+
+func (ui *Tpcli) moveFocusToPreviousPanel() {
+	ui.indexInOrderOfPanelWithFocus--
+	if ui.indexInOrderOfPanelWithFocus < 0 {
+		ui.indexInOrderOfPanelWithFocus = len(ui.panelTypesInOrder) - 1
+	}
+	ui.focusPanelWithFocusIndex()
+	ui.keepFocusedPanelMaximized()
+	ui.emitEvent(&Event{Type: FocusChanged, PanelWithFocus: ui.panelWithFocus()})
+}
+
+// focusedOutputPanel returns the output panel that has focus, or nil if the command panel has focus.
+func (ui *Tpcli) focusedOutputPanel() *outputPanel {
+	switch ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus] {
+	case generalOutputPanel:
+		return ui.generalOutputPanel
+	case errorOrHistoryPanel:
+		return ui.errorOrHistoryPanel
+	default:
+		return nil
+	}
+}
+
+func (ui *Tpcli) panelWithFocus() Panel {
+	return panelOfType(ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus])
+}
+
+func panelOfType(panelType panelTypes) Panel {
+	switch panelType {
+	case commandPanel:
+		return CommandPanel
+	case generalOutputPanel:
+		return GeneralOutputPanel
+	default:
+		return ErrorOrHistoryPanel
+	}
+}
+
+func typeOfPanel(panel Panel) panelTypes {
+	switch panel {
+	case CommandPanel:
+		return commandPanel
+	case GeneralOutputPanel:
+		return generalOutputPanel
+	default:
+		return errorOrHistoryPanel
+	}
+}
+
+func (ui *Tpcli) focusPanelWithFocusIndex() {
+	switch ui.panelTypesInOrder[ui.indexInOrderOfPanelWithFocus] {
+	case commandPanel:
+		ui.tviewApplication.SetFocus(ui.commandInputPanel.BackingTviewObject())
+	case generalOutputPanel:
+		ui.tviewApplication.SetFocus(ui.generalOutputPanel.BackingTviewObject())
+	default:
+		ui.tviewApplication.SetFocus(ui.errorOrHistoryPanel.BackingTviewObject())
+	}
+}
+
 type commandInputPanel struct {
-	promptTextWithTrailingSpace string
-	parentTviewApplication      *tview.Application
-	tviewInputField             *tview.InputField
-	userCommandReadlineHistory  *ReadlineHistory
-	callbackOnEnteredCommand    func(string)
+	promptTextWithTrailingSpace            string
+	parentTviewApplication                 *tview.Application
+	inputField                             *commandInputField
+	userCommandReadlineHistory             *ReadlineHistory
+	callbackOnEnteredCommand               func(string)
+	completer                              Completer
+	callbackOnMultipleCompletionCandidates func([]string)
+	activeReverseSearch                    *reverseHistorySearch
+	historyNavigationIsPrefixFiltered      bool
+	historyNavigationPrefix                string
+	commandTextSetByHistoryNavigation      *string                       // nil unless the last change to the command text was from history navigation
+	commandIsComplete                      func(commandText string) bool // nil unless multi-line input is used
+	viEditing                              *viEditingState               // nil unless vi editing mode is used
+	promptProvider                         func() string
 }
 
-func newCommandInputPanel(parentTviewApplication *tview.Application) *commandInputPanel {
+func newCommandInputPanel(parentTviewApplication *tview.Application, userCommandReadlineHistory *ReadlineHistory) *commandInputPanel {
 	panel := &commandInputPanel{
-		parentTviewApplication:      parentTviewApplication,
-		promptTextWithTrailingSpace: "Enter command> ",
-		userCommandReadlineHistory:  NewReadlineHistory(200),
+		parentTviewApplication:                 parentTviewApplication,
+		promptTextWithTrailingSpace:            "Enter command> ",
+		userCommandReadlineHistory:             userCommandReadlineHistory,
+		callbackOnMultipleCompletionCandidates: func([]string) {},
 	}
 
-	panel.createPanelTviewInputField()
+	panel.createPanelInputField()
 
 	return panel
 }
 
-func (panel *commandInputPanel) ChangePromptTo(promptWithoutTrainingSpace string) *commandInputPanel {
-	panel.promptTextWithTrailingSpace = promptWithoutTrainingSpace + " "
+const (
+	defaultCommandPanelRows = 3
+	maximumCommandPanelRows = 10
+)
+
+// resizeCommandPanelToFit grows (or shrinks) the command panel so that it shows numberOfLines lines of a multi-line
+// command, within the command panel's size and the maximum command panel size.  This must be invoked from the tview
+// event loop.
+func (ui *Tpcli) resizeCommandPanelToFit(numberOfLines int) {
+	ui.linesInCommand = numberOfLines
+	ui.layOutPanels()
+}
+
+// ChangePromptTo sets the prompt, showing it immediately unless a history search is active (in which case it is shown
+// when the search ends).
+func (panel *commandInputPanel) ChangePromptTo(promptWithoutTrailingSpace string) *commandInputPanel {
+	panel.promptTextWithTrailingSpace = promptWithoutTrailingSpace + " "
+	if !panel.IsSearchingHistory() {
+		panel.inputField.SetLabel(panel.labelForCurrentEditingState())
+	}
+	return panel
+}
+
+func (panel *commandInputPanel) UsePromptProvider(provider func() string) *commandInputPanel {
+	panel.promptProvider = provider
+	panel.refreshPromptFromProvider()
 	return panel
 }
 
+func (panel *commandInputPanel) refreshPromptFromProvider() {
+	if panel.promptProvider != nil {
+		panel.ChangePromptTo(panel.promptProvider())
+	}
+}
+
 func (panel *commandInputPanel) BackingTviewObject() tview.Primitive {
-	return panel.tviewInputField
+	return panel.inputField
 }
 
 func (panel *commandInputPanel) WhenACommandIsEntered(doThis func(commandWithoutTrailingNewline string)) *commandInputPanel {
@@ -326,57 +863,170 @@ func (panel *commandInputPanel) WhenACommandIsEntered(doThis func(commandWithout
 	return panel
 }
 
+func (panel *commandInputPanel) CompleteUsing(completer Completer) *commandInputPanel {
+	panel.completer = completer
+	return panel
+}
+
+func (panel *commandInputPanel) WhenThereAreMultipleCompletionCandidates(doThis func(candidates []string)) *commandInputPanel {
+	panel.callbackOnMultipleCompletionCandidates = doThis
+	return panel
+}
+
 func (panel *commandInputPanel) ChangeCommandStringTo(newString string) {
-	panel.tviewInputField.SetText(newString)
+	panel.inputField.SetText(newString)
 }
 
-func (panel *commandInputPanel) createPanelTviewInputField() {
-	panel.tviewInputField = tview.NewInputField().
+func (panel *commandInputPanel) createPanelInputField() {
+	panel.inputField = newCommandInputField().
 		SetLabel(panel.promptTextWithTrailingSpace).
-		SetFieldBackgroundColor(tcell.ColorBlack).
-		SetFieldWidth(100).
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
-				userProvidedCommandTextTrimmed := strings.TrimSpace(panel.tviewInputField.GetText())
-
-				panel.userCommandReadlineHistory.AddItem(userProvidedCommandTextTrimmed)
-				panel.userCommandReadlineHistory.ResetIteration()
-				panel.callbackOnEnteredCommand(userProvidedCommandTextTrimmed)
-				panel.tviewInputField.SetText("")
+				if panel.commandIsComplete != nil && !panel.commandIsComplete(panel.inputField.GetText()) {
+					panel.inputField.Insert("\n")
+					return
+				}
+				panel.submitCommand()
 			}
 		})
 
-	panel.tviewInputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyUp {
-			panel.tviewInputField.SetText(panel.userCommandReadlineHistory.Up())
+	panel.inputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if panel.IsSearchingHistory() {
+			if event = panel.handleKeyDuringReverseHistorySearch(event); event == nil {
+				return nil
+			}
+		}
+
+		if panel.UsesViEditing() {
+			if event = panel.handleKeyInViEditingMode(event); event == nil {
+				return nil
+			}
+		}
+
+		switch event.Key() {
+		case tcell.KeyCtrlR:
+			panel.beginReverseHistorySearch()
 			return nil
-		} else if event.Key() == tcell.KeyDown {
-			panel.tviewInputField.SetText(panel.userCommandReadlineHistory.Down())
+		case tcell.KeyUp:
+			if panel.inputField.editor.MoveUpALine() {
+				return nil
+			}
+			panel.navigateHistory(panel.userCommandReadlineHistory.Up, panel.userCommandReadlineHistory.UpWithPrefix)
 			return nil
-		} else {
-			return event
+		case tcell.KeyDown:
+			if panel.inputField.editor.MoveDownALine() {
+				return nil
+			}
+			panel.navigateHistory(panel.userCommandReadlineHistory.Down, panel.userCommandReadlineHistory.DownWithPrefix)
+			return nil
+		case tcell.KeyTab:
+			if panel.completer != nil {
+				panel.completeWordBeforeCursor()
+				return nil
+			}
 		}
+
+		return event
 	})
 }
 
+// submitCommand delivers the text in the command input panel, adds it to the command history, and clears the panel
+// for the next command.
+func (panel *commandInputPanel) submitCommand() {
+	userProvidedCommandText := panel.inputField.GetText()
+	userProvidedCommandTextTrimmed := strings.TrimSpace(userProvidedCommandText)
+
+	panel.userCommandReadlineHistory.AddItem(userProvidedCommandText)
+	panel.userCommandReadlineHistory.ResetIteration()
+	panel.callbackOnEnteredCommand(userProvidedCommandTextTrimmed)
+	panel.refreshPromptFromProvider()
+	panel.inputField.SetText("")
+	panel.commandTextSetByHistoryNavigation = nil
+	if panel.UsesViEditing() {
+		panel.resetViEditingForNextCommand()
+	}
+}
+
+// discardCommand abandons the text in the command input panel (and any history search) without delivering it, as
+// an interrupt does in a shell.
+func (panel *commandInputPanel) discardCommand() {
+	if panel.IsSearchingHistory() {
+		panel.endReverseHistorySearch("")
+	}
+	panel.userCommandReadlineHistory.ResetIteration()
+	panel.inputField.SetText("")
+	panel.commandTextSetByHistoryNavigation = nil
+	if panel.UsesViEditing() {
+		panel.resetViEditingForNextCommand()
+	}
+}
+
+// navigateHistory moves through the command history using either move or, if history navigation is prefix filtered,
+// moveWithPrefix.  The prefix is the text in the command input panel when navigation begins.  Navigation begins anew
+// whenever the text has been changed by anything other than history navigation.
+func (panel *commandInputPanel) navigateHistory(move func() string, moveWithPrefix func(prefix string) string) {
+	if !panel.historyNavigationIsPrefixFiltered {
+		panel.inputField.SetText(move())
+		return
+	}
+
+	if panel.commandTextSetByHistoryNavigation == nil || *panel.commandTextSetByHistoryNavigation != panel.inputField.GetText() {
+		panel.historyNavigationPrefix = panel.inputField.GetText()
+		panel.userCommandReadlineHistory.ResetIteration()
+	}
+
+	newCommandText := moveWithPrefix(panel.historyNavigationPrefix)
+	if newCommandText == "" {
+		newCommandText = panel.historyNavigationPrefix
+	}
+
+	panel.inputField.SetText(newCommandText)
+	panel.commandTextSetByHistoryNavigation = &newCommandText
+}
+
 type outputPanel struct {
-	textView *tview.TextView
+	textView           *tview.TextView
+	title              string
+	hasText            bool
+	timestampLayout    string
+	showSourceTags     bool
+	translatesANSI     bool
+	theme              *Theme
+	findMatchColorTags string
+	maximumLines       int         // 0 for no limit
+	find               *outputFind // nil unless the panel is in find mode
 }
 
-func newOutputPanel(parentTviewApplication *tview.Application) *outputPanel {
+// newOutputPanel creates an output panel.  Text must be added to it only from the UI goroutine, which redraws after
+// each update, so it does not redraw when its text changes.
+func newOutputPanel() *outputPanel {
 	textView := tview.NewTextView()
 
+	// text is escaped (or translated from ANSI escape sequences) as it is appended, so that only the tags added for
+	// styles are interpreted
 	textView.
+		SetDynamicColors(true).
 		SetBorder(true).
 		SetTitleAlign(tview.AlignLeft)
 
-	textView.SetChangedFunc(func() {
-		parentTviewApplication.Draw()
-	})
-
-	return &outputPanel{
+	panel := &outputPanel{
 		textView: textView,
 	}
+
+	textView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if panel.IsFinding() {
+			return panel.handleKeyDuringFind(event)
+		}
+
+		if event.Key() == tcell.KeyRune && event.Rune() == '/' {
+			panel.BeginFind()
+			return nil
+		}
+
+		return event
+	})
+
+	return panel
 }
 
 func (panel *outputPanel) BackingTviewObject() tview.Primitive {
@@ -384,23 +1034,54 @@ func (panel *outputPanel) BackingTviewObject() tview.Primitive {
 }
 
 func (panel *outputPanel) SetTitleTo(newTitle string) *outputPanel {
+	panel.title = newTitle
 	panel.textView.SetTitle(newTitle)
 	return panel
 }
 
+// ApplySettings limits the lines the panel retains (dropping the oldest lines when there are more), sets the
+// decorations added to each line of text, and sets whether ANSI escape sequences are translated.
+func (panel *outputPanel) ApplySettings(settings *outputPanelSettings) *outputPanel {
+	panel.maximumLines = int(settings.maximumLines)
+	panel.textView.SetMaxLines(panel.maximumLines)
+	panel.timestampLayout = settings.timestampLayout
+	panel.showSourceTags = settings.showSourceTags
+	panel.translatesANSI = settings.translateANSI
+	return panel
+}
+
+// AppendText adds s on a new line after any text already in the panel.  s may contain tview color tags, so text that
+// should be shown literally must be escaped (AppendTextFrom does this).  Its cost does not depend on the amount of
+// text already in the panel.
 func (panel *outputPanel) AppendText(s string) {
-	if panel.textView.GetText(false) == "" {
-		fmt.Fprint(panel.textView, s)
-	} else {
+	if panel.IsFinding() {
+		if panel.hasText {
+			s = "\n" + s
+		}
+		panel.appendTextDuringFind(s)
+		panel.hasText = true
+		return
+	}
+
+	if panel.hasText {
 		fmt.Fprintf(panel.textView, "\n%s", s)
+	} else {
+		fmt.Fprint(panel.textView, s)
+		panel.hasText = true
 	}
 }
 
 func (panel *outputPanel) Write(p []byte) (int, error) {
-	panel.AppendText(string(p))
+	panel.AppendText(tview.Escape(string(p)))
 	return len(p), nil
 }
 
 func (panel *outputPanel) Clear() {
+	panel.EndFind()
 	panel.textView.SetText("")
+	panel.hasText = false
+}
+
+func (panel *outputPanel) ScrollToEnd() {
+	panel.textView.ScrollToEnd()
 }
@@ -0,0 +1,1104 @@
+package tpcli_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blorticus/tpcli"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tpcli", func() {
+	var (
+		ui                   *tpcli.Tpcli
+		exitFunctionWasFired bool
+	)
+
+	BeforeEach(func() {
+		exitFunctionWasFired = false
+		ui = tpcli.NewUI().
+			UsingSimulationScreenOfSize(80, 30).
+			OnUIExit(func() { exitFunctionWasFired = true })
+	})
+
+	AfterEach(func() {
+		ui.Stop()
+	})
+
+	Context("with default panels", func() {
+		JustBeforeEach(func() {
+			ui.Start()
+		})
+
+		It("should show the prompt in the command panel", func() {
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+
+		It("should deliver an entered command on the command channel and clear the command panel", func() {
+			ui.SimulateTypingOf("do something")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> do something"))
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(Equal("do something")))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+
+		It("should render text added to the general and error output panels", func() {
+			ui.AddStringToGeneralOutput("first line")
+			ui.FmtToGeneralOutput("second %s", "line")
+			ui.AddStringToErrorOutput("an error")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:3]).To(Equal([]string{"first line", "second line", ""}))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0:2]).To(Equal([]string{"an error", ""}))
+		})
+
+		It("should act as a Writer for the general output panel", func() {
+			fmt.Fprint(ui, "written line")
+			ui.AddStringToGeneralOutput("added line")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:3]).To(Equal([]string{"written line", "added line", ""}))
+		})
+
+		It("should recall earlier commands with the up and down arrows", func() {
+			ui.SimulateTypingOf("first")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf("second")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> second"))
+
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> first"))
+
+			ui.SimulateKeyPress(tcell.KeyDown, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyDown, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+
+		It("should support reverse incremental history search with ^r", func() {
+			for _, command := range []string{"connect to foo", "read file", "connect to bar"} {
+				ui.SimulateTypingOf(command)
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			}
+			ui.SimulateTypingOf("partial")
+
+			ui.SimulateKeyPress(tcell.KeyCtrlR, 0, tcell.ModNone)
+			ui.SimulateTypingOf("con")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(reverse-i-search)'con': connect to bar"))
+
+			ui.SimulateKeyPress(tcell.KeyCtrlR, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(reverse-i-search)'con': connect to foo"))
+
+			ui.SimulateKeyPress(tcell.KeyCtrlR, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(failed reverse-i-search)'con': connect to foo"))
+
+			By("cancelling with <esc>, which does not exit")
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> partial"))
+
+			By("accepting with <enter>")
+			ui.SimulateKeyPress(tcell.KeyCtrlR, 0, tcell.ModNone)
+			ui.SimulateTypingOf("rea")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> read file"))
+		})
+
+		It("should yank killed text and rotate through earlier kills", func() {
+			ui.SimulateTypingOf("one two three")
+			ui.SimulateKeyPress(tcell.KeyCtrlW, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyCtrlW, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> one"))
+
+			ui.SimulateKeyPress(tcell.KeyCtrlA, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyCtrlK, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+
+			ui.SimulateTypingOf("x ")
+			ui.SimulateKeyPress(tcell.KeyCtrlY, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> x one"))
+
+			ui.SimulateKeyPress(tcell.KeyRune, 'y', tcell.ModAlt)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> x two three"))
+
+			ui.SimulateKeyPress(tcell.KeyRune, 'y', tcell.ModAlt)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> x one"))
+
+			ui.SimulateTypingOf("!")
+			ui.SimulateKeyPress(tcell.KeyRune, 'y', tcell.ModAlt)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> x one !"))
+		})
+
+		It("should require a command history of at least one entry", func() {
+			Expect(func() { ui.LimitingCommandHistoryTo(0) }).To(Panic())
+		})
+
+		It("should exit on <esc>", func() {
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeTrue())
+		})
+	})
+
+	Context("using the command history panel", func() {
+		JustBeforeEach(func() {
+			ui.UsingCommandHistoryPanel().Start()
+		})
+
+		It("should copy entered commands to the history panel and redirect error output", func() {
+			ui.SimulateTypingOf("do something")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.AddStringToErrorOutput("an error")
+
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0:2]).To(Equal([]string{"do something", ""}))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:2]).To(Equal([]string{"an error", ""}))
+		})
+	})
+
+	Context("using prefix filtered history navigation", func() {
+		JustBeforeEach(func() {
+			ui.UsingPrefixFilteredHistoryNavigation().Start()
+			for _, command := range []string{"connect to foo", "read file", "connect to bar"} {
+				ui.SimulateTypingOf(command)
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			}
+		})
+
+		It("should walk only entries starting with the typed text", func() {
+			ui.SimulateTypingOf("con")
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> connect to bar"))
+
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> connect to foo"))
+
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> connect to foo"))
+
+			ui.SimulateKeyPress(tcell.KeyDown, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyDown, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> con"))
+		})
+
+		It("should walk all entries when nothing is typed", func() {
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> read file"))
+		})
+	})
+
+	Context("with a completer", func() {
+		var lineAndCursorGivenToCompleter []interface{}
+
+		JustBeforeEach(func() {
+			ui.CompletingCommandsUsing(func(currentLine string, cursorPosition int) []string {
+				lineAndCursorGivenToCompleter = []interface{}{currentLine, cursorPosition}
+				candidates := []string{}
+				for _, word := range []string{"connect", "configure", "quit"} {
+					if strings.HasPrefix(word, currentLine[strings.LastIndex(currentLine[:cursorPosition], " ")+1:cursorPosition]) {
+						candidates = append(candidates, word)
+					}
+				}
+				return candidates
+			}).Start()
+		})
+
+		It("should complete a single candidate inline", func() {
+			ui.SimulateTypingOf("show q")
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			Expect(lineAndCursorGivenToCompleter).To(Equal([]interface{}{"show q", 6}))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> show quit"))
+		})
+
+		It("should extend to the common prefix, then list the candidates", func() {
+			ui.SimulateTypingOf("c")
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> con"))
+
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> con"))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0]).To(Equal("connect  configure"))
+		})
+
+		It("should pass the cursor position to the completer", func() {
+			ui.SimulateTypingOf("x q")
+			ui.SimulateKeyPress(tcell.KeyLeft, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyLeft, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			Expect(lineAndCursorGivenToCompleter).To(Equal([]interface{}{"x q", 1}))
+		})
+
+		It("should use <shift>-<tab> to cycle focus", func() {
+			ui.SimulateKeyPress(tcell.KeyBacktab, 0, tcell.ModNone)
+			ui.SimulateTypingOf("ignored")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+	})
+
+	Context("with an argument hinter", func() {
+		JustBeforeEach(func() {
+			processor := tpcli.NewCommandProcessor().
+				WhenCommandFollowsGrammar("connect to <host> port <port:int>", func([]string) error { return nil })
+			ui.HintingCommandsUsing(processor.ArgumentHintFor).Start()
+		})
+
+		It("should show the hint after the command text", func() {
+			ui.SimulateTypingOf("connect")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> connect to <host> port <port:int>"))
+
+			ui.SimulateTypingOf(" to foo ")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> connect to foo port <port:int>"))
+		})
+	})
+
+	Context("with multi-line command input", func() {
+		JustBeforeEach(func() {
+			ui.UsingMultiLineCommandInput(func(commandText string) bool {
+				return tpcli.CommandHasBalancedBrackets(commandText) && tpcli.CommandHasNoTrailingBackslash(commandText)
+			}).Start()
+		})
+
+		It("should continue an incomplete command on the next line and deliver the full text", func() {
+			ui.SimulateTypingOf("post {")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf(`"a": 1`)
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf("}")
+
+			Expect(ui.RenderedTextOfCommandPanel()).To(Equal([]string{
+				"Enter command> post {",
+				`               "a": 1`,
+				"               }",
+			}))
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(Equal("post {\n\"a\": 1\n}")))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+
+		It("should grow the command panel with the content, then shrink it again", func() {
+			for i := 1; i <= 4; i++ {
+				ui.SimulateTypingOf(fmt.Sprintf("line %d \\", i))
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			}
+			ui.SimulateTypingOf("line 5")
+
+			Expect(ui.RenderedTextOfCommandPanel()).To(HaveLen(5))
+			Expect(ui.RenderedTextOfCommandPanel()[4]).To(Equal("               line 5"))
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(HavePrefix("line 1 \\\nline 2")))
+			Expect(ui.RenderedTextOfCommandPanel()).To(HaveLen(3))
+		})
+
+		It("should move between lines with the arrow keys before moving through the history", func() {
+			ui.SimulateTypingOf("earlier")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+
+			ui.SimulateTypingOf("ab \\")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf("cd")
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			ui.SimulateTypingOf("X")
+			Expect(ui.RenderedTextOfCommandPanel()[0:2]).To(Equal([]string{"Enter command> abX \\", "               cd"}))
+
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> earlier"))
+		})
+
+		It("should kill only to the end or start of the line with the cursor", func() {
+			ui.SimulateTypingOf("one \\")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf("two \\")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateTypingOf("three")
+			ui.SimulateKeyPress(tcell.KeyUp, 0, tcell.ModNone)
+
+			ui.SimulateKeyPress(tcell.KeyCtrlA, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyCtrlK, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()).To(Equal([]string{"Enter command> one \\", "", "               three"}))
+
+			ui.SimulateKeyPress(tcell.KeyCtrlY, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[1]).To(Equal("               two \\"))
+
+			ui.SimulateKeyPress(tcell.KeyCtrlU, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()).To(Equal([]string{"Enter command> one \\", "", "               three"}))
+		})
+	})
+
+	Context("with vi editing mode", func() {
+		JustBeforeEach(func() {
+			ui.UsingViEditingMode().Start()
+		})
+
+		pressRunes := func(runes string) {
+			for _, r := range runes {
+				ui.SimulateKeyPress(tcell.KeyRune, r, tcell.ModNone)
+			}
+		}
+
+		It("should show the editing state in the prompt", func() {
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(ins) Enter command>"))
+
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command>"))
+			Expect(exitFunctionWasFired).To(BeFalse())
+
+			pressRunes("i")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(ins) Enter command>"))
+		})
+
+		It("should support motions, operators, put and undo in the normal state", func() {
+			ui.SimulateTypingOf("one two three")
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+
+			pressRunes("bdw")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> one two"))
+
+			pressRunes("0P")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> threeone two"))
+
+			pressRunes("u0cwONE")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(ins) Enter command> ONE two"))
+
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+			pressRunes("wx$p")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> ONE wo t"))
+
+			pressRunes("uu")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> ONE two"))
+
+			pressRunes("yyAX")
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+			pressRunes("p")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> ONE two XONE two"))
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(Equal("ONE two XONE two")))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(ins) Enter command>"))
+		})
+
+		It("should navigate and search the history in the normal state", func() {
+			for _, command := range []string{"first", "second"} {
+				ui.SimulateTypingOf(command)
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			}
+
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+			pressRunes("kk")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> first"))
+			pressRunes("j")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> second"))
+
+			pressRunes("/fi")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(reverse-i-search)'fi': first"))
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(cmd) Enter command> first"))
+		})
+	})
+
+	Context("with a changed prompt", func() {
+		It("should show a prompt set before the UI starts", func() {
+			ui.ChangePromptTo("[green]ready[white]>").Start()
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("ready>"))
+
+			ui.SimulateTypingOf("go")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("ready> go"))
+		})
+
+		It("should show a prompt changed from another goroutine after the UI starts", func() {
+			ui.Start()
+			ui.SimulateTypingOf("go")
+
+			done := make(chan struct{})
+			go func() {
+				ui.ChangePromptTo(tview.Escape("[connected:host1]>"))
+				close(done)
+			}()
+			Eventually(done, time.Second).Should(BeClosed())
+
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("[connected:host1]> go"))
+		})
+
+		It("should re-evaluate the prompt provider after each command and on refresh", func() {
+			connectedHost := "none"
+			hostLock := sync.Mutex{}
+			ui.UsingPromptProvider(func() string {
+				hostLock.Lock()
+				defer hostLock.Unlock()
+				return fmt.Sprintf("(%s)>", connectedHost)
+			}).Start()
+
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(none)>"))
+
+			hostLock.Lock()
+			connectedHost = "host1"
+			hostLock.Unlock()
+
+			ui.SimulateTypingOf("connect host1")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(host1)>"))
+
+			hostLock.Lock()
+			connectedHost = "host2"
+			hostLock.Unlock()
+
+			ui.RefreshPrompt()
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(host2)>"))
+		})
+
+		It("should change and refresh the prompt from key binding callbacks", func() {
+			refreshes := 0
+			ui.UsingPromptProvider(func() string {
+				refreshes++
+				return fmt.Sprintf("(%d)>", refreshes)
+			}).
+				BindingKeyTo("F2", func() { ui.ChangePromptTo("changed>") }).
+				BindingKeyTo("F3", func() { ui.RefreshPrompt() }).
+				Start()
+
+			ui.SimulateKeyPress(tcell.KeyF2, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("changed>"))
+
+			ui.SimulateKeyPress(tcell.KeyF3, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("(2)>"))
+		})
+	})
+
+	Context("with configured exit commands and keys", func() {
+		JustBeforeEach(func() {
+			ui.ExitingOnCommands("bye").ExitingOnKeys(tcell.KeyCtrlQ).Start()
+		})
+
+		It("should exit only on the configured command", func() {
+			ui.SimulateTypingOf("exit")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(Equal("exit")))
+			Expect(exitFunctionWasFired).To(BeFalse())
+
+			ui.SimulateTypingOf("bye")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeTrue())
+		})
+
+		It("should exit only on the configured key", func() {
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+
+			ui.SimulateKeyPress(tcell.KeyCtrlQ, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeTrue())
+		})
+	})
+
+	Context("with exits disabled", func() {
+		It("should not exit on any command or key", func() {
+			ui.ExitingOnCommands().ExitingOnKeys().Start()
+
+			ui.SimulateTypingOf("quit")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyCtrlQ, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+		})
+	})
+
+	Context("confirming exit", func() {
+		JustBeforeEach(func() {
+			ui.ConfirmingExit().Start()
+		})
+
+		screenShowsConfirmation := func() bool {
+			return strings.Contains(strings.Join(ui.RenderedTextOfScreen(), "\n"), "Really quit?")
+		}
+
+		It("should ask before exiting, and return to the command panel if the answer is no", func() {
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+			Expect(screenShowsConfirmation()).To(BeTrue())
+
+			ui.SimulateTypingOf("n")
+			Expect(exitFunctionWasFired).To(BeFalse())
+			Expect(screenShowsConfirmation()).To(BeFalse())
+
+			ui.SimulateTypingOf("ok")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> ok"))
+		})
+
+		It("should treat <esc> as no", func() {
+			ui.SimulateKeyPress(tcell.KeyCtrlQ, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+			Expect(screenShowsConfirmation()).To(BeFalse())
+		})
+
+		It("should exit after an exit command if the answer is yes", func() {
+			ui.SimulateTypingOf("quit")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(screenShowsConfirmation()).To(BeTrue())
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeTrue())
+		})
+	})
+
+	Context("with key bindings", func() {
+		var chordWasPressed bool
+
+		JustBeforeEach(func() {
+			chordWasPressed = false
+			ui.BindingKeyTo("Ctrl-X Ctrl-S", func() { chordWasPressed = true }).
+				BindingKeyToAction("Ctrl-L", tpcli.ClearGeneralOutput).
+				BindingKeyToAction("F2", tpcli.SubmitCommand).
+				BindingKeyTo("F3", func() { ui.ReplaceCommandStringWith("replaced") }).
+				UsingMultiLineCommandInput(tpcli.CommandHasBalancedBrackets).
+				Start()
+		})
+
+		It("should execute a callback bound to a chord", func() {
+			ui.SimulateKeyPress(tcell.KeyCtrlX, 0, tcell.ModCtrl)
+			Expect(chordWasPressed).To(BeFalse())
+			ui.SimulateKeyPress(tcell.KeyCtrlS, 0, tcell.ModCtrl)
+			Expect(chordWasPressed).To(BeTrue())
+		})
+
+		It("should discard an incomplete chord and process the next key normally", func() {
+			ui.SimulateKeyPress(tcell.KeyCtrlX, 0, tcell.ModCtrl)
+			ui.SimulateTypingOf("a")
+			Expect(chordWasPressed).To(BeFalse())
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> a"))
+		})
+
+		It("should replace the command string from a callback without blocking the UI", func() {
+			ui.SimulateTypingOf("abc")
+			ui.SimulateKeyPress(tcell.KeyF3, 0, tcell.ModNone)
+			ui.SimulateTypingOf("d")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> replacedd"))
+		})
+
+		It("should perform built-in actions", func() {
+			ui.AddStringToGeneralOutput("some output")
+			ui.SimulateKeyPress(tcell.KeyCtrlL, 0, tcell.ModCtrl)
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0]).To(Equal(""))
+
+			ui.SimulateTypingOf("post {")
+			ui.SimulateKeyPress(tcell.KeyF2, 0, tcell.ModNone)
+			Eventually(ui.ChannelOfEnteredCommands(), time.Second).Should(Receive(Equal("post {")))
+		})
+	})
+
+	Context("with panel sizes", func() {
+		JustBeforeEach(func() {
+			ui.SizingPanel(tpcli.ErrorOrHistoryPanel, tpcli.FixedRows(8)).
+				BindingKeyToAction("F5", tpcli.GrowFocusedPanel).
+				BindingKeyToAction("F6", tpcli.ShrinkFocusedPanel).
+				BindingKeyToAction("F7", tpcli.ToggleMaximizedPanel).
+				Start()
+		})
+
+		It("should give the general output panel the rows left by the fixed panels", func() {
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(6))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(17))
+		})
+
+		It("should grow and shrink the panel with focus", func() {
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyF5, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(7))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(16))
+
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyF5, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyF5, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(5))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(18))
+
+			for i := 0; i < 10; i++ {
+				ui.SimulateKeyPress(tcell.KeyF5, 0, tcell.ModNone)
+			}
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(1))
+		})
+
+		It("should maximize the panel with focus, and restore the panels", func() {
+			ui.AddStringToErrorOutput("an error")
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyF7, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfScreen()[1]).To(HavePrefix("│an error "))
+			Expect(ui.RenderedTextOfScreen()[26]).To(HavePrefix("└"))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+
+			ui.SimulateKeyPress(tcell.KeyF7, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(6))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(17))
+		})
+
+		It("should only allow the command panel to have a fixed size", func() {
+			Expect(func() { ui.SizingPanel(tpcli.CommandPanel, tpcli.ProportionOfRemainingRows(1)) }).To(Panic())
+		})
+	})
+
+	Context("with a layout", func() {
+		It("should place panels side by side", func() {
+			layout, err := tpcli.ParseLayout("o|e/c")
+			Expect(err).To(BeNil())
+			ui.UsingLayout(layout).Start()
+
+			ui.AddStringToGeneralOutput("some output")
+			ui.AddStringToErrorOutput("an error")
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(25))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()).To(HaveLen(25))
+
+			secondRowOfScreen := []rune(ui.RenderedTextOfScreen()[1])
+			Expect(string(secondRowOfScreen[0:12])).To(Equal("│some output"))
+			Expect(string(secondRowOfScreen[40:49])).To(Equal("│an error"))
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+		})
+
+		It("should share columns by width weight", func() {
+			ui.UsingLayout(tpcli.PanelsSideBySide(
+				tpcli.LayoutOfPanel(tpcli.GeneralOutputPanel).WithWidthWeight(3),
+				tpcli.PanelsStackedVertically(tpcli.LayoutOfPanel(tpcli.ErrorOrHistoryPanel), tpcli.LayoutOfPanel(tpcli.CommandPanel)))).
+				Start()
+
+			ui.AddStringToErrorOutput("an error")
+			Expect(string([]rune(ui.RenderedTextOfScreen()[1])[60:69])).To(Equal("│an error"))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(28))
+		})
+
+		It("should keep a maximized panel side by side with the command panel", func() {
+			layout, err := tpcli.ParseLayout("2*(o/e)|c")
+			Expect(err).To(BeNil())
+			ui.UsingLayout(layout).BindingKeyToAction("F7", tpcli.ToggleMaximizedPanel).Start()
+
+			ui.AddStringToGeneralOutput("some output")
+			ui.SimulateKeyPress(tcell.KeyF7, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfGeneralOutputPanel()).To(HaveLen(28))
+
+			Expect(ui.RenderedTextOfScreen()[1]).To(HavePrefix("│some output"))
+			Expect(string([]rune(ui.RenderedTextOfScreen()[0])[53:])).To(Equal("Enter command>"))
+		})
+
+		It("should parse layout expressions, and describe layouts as expressions", func() {
+			for _, expression := range []string{"o/e/c", "o|e/c", "2*o|(e/c)", "c/(o/e)", "(o/e)|c"} {
+				layout, err := tpcli.ParseLayout(expression)
+				Expect(err).To(BeNil())
+				Expect(layout.AsString()).To(Equal(expression))
+			}
+
+			layout, err := tpcli.ParseLayout(" o | h / c ")
+			Expect(err).To(BeNil())
+			Expect(layout.AsString()).To(Equal("o|e/c"))
+
+			for _, expression := range []string{"", "o|e", "o/e/c/o", "o|x/c", "(o|e/c", "o|e/c)", "2*o/e/c", "0*o|e/c", "2o|e/c"} {
+				_, err := tpcli.ParseLayout(expression)
+				Expect(err).ToNot(BeNil(), expression)
+			}
+		})
+
+		It("should only allow layouts that include each panel exactly once", func() {
+			Expect(func() {
+				ui.UsingLayout(tpcli.PanelsStackedVertically(tpcli.LayoutOfPanel(tpcli.GeneralOutputPanel), tpcli.LayoutOfPanel(tpcli.CommandPanel)))
+			}).To(Panic())
+		})
+	})
+
+	Context("with output written from many goroutines", func() {
+		It("should show output written before Start, and keep the order of each goroutine's writes", func() {
+			ui.AddStringToGeneralOutput("written before start")
+			ui.LimitingRedrawsTo(10).Start()
+
+			var writers sync.WaitGroup
+			for writer := 0; writer < 3; writer++ {
+				writers.Add(1)
+				go func(writer int) {
+					defer writers.Done()
+					for line := 0; line < 4; line++ {
+						ui.FmtToGeneralOutput("%d.%d", writer, line)
+					}
+				}(writer)
+			}
+			writers.Wait()
+
+			renderedText := ui.RenderedTextOfGeneralOutputPanel()
+			Expect(renderedText[0]).To(Equal("written before start"))
+
+			lastLineSeenFromWriter := map[string]int{"0": -1, "1": -1, "2": -1}
+			for _, renderedLine := range renderedText[1:13] {
+				var writer, line int
+				_, err := fmt.Sscanf(renderedLine, "%d.%d", &writer, &line)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(line).To(Equal(lastLineSeenFromWriter[fmt.Sprint(writer)] + 1))
+				lastLineSeenFromWriter[fmt.Sprint(writer)] = line
+			}
+		})
+	})
+
+	Context("with limited panel lines", func() {
+		JustBeforeEach(func() {
+			ui.LimitingPanelLinesTo(tpcli.GeneralOutputPanel, 3).Start()
+		})
+
+		It("should drop the oldest lines", func() {
+			for line := 1; line <= 10; line++ {
+				ui.FmtToGeneralOutput("line %d", line)
+			}
+			ui.AddStringToErrorOutput("unlimited")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:4]).To(Equal([]string{"line 8", "line 9", "line 10", ""}))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0]).To(Equal("unlimited"))
+		})
+
+		It("should not allow the command panel to be limited", func() {
+			Expect(func() { ui.LimitingPanelLinesTo(tpcli.CommandPanel, 1) }).To(Panic())
+		})
+	})
+
+	Context("with line decorations", func() {
+		JustBeforeEach(func() {
+			ui.TimestampingPanelLinesUsing(tpcli.GeneralOutputPanel, "2006").
+				ShowingSourceTagsIn(tpcli.GeneralOutputPanel).
+				ShowingSourceTagsIn(tpcli.ErrorOrHistoryPanel).
+				Start()
+		})
+
+		It("should add the timestamp and source tag to each line", func() {
+			year := time.Now().Format("2006")
+
+			ui.AddStringFromSourceToGeneralOutput("peer", "first\nsecond")
+			ui.AddStringToGeneralOutput("no source")
+			ui.AddStringFromSourceToErrorOutput("local", "an error")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:3]).To(Equal([]string{
+				year + " [peer] first",
+				year + " [peer] second",
+				year + " no source",
+			}))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0]).To(Equal("[local] an error"))
+		})
+
+		It("should not allow the command panel to be decorated", func() {
+			Expect(func() { ui.TimestampingPanelLinesUsing(tpcli.CommandPanel, "15:04") }).To(Panic())
+			Expect(func() { ui.ShowingSourceTagsIn(tpcli.CommandPanel) }).To(Panic())
+		})
+	})
+
+	Context("with leveled output", func() {
+		JustBeforeEach(func() {
+			ui.ShowingOutputAtOrAboveLevel(tpcli.GeneralOutputPanel, tpcli.InfoLevel).
+				ShowingSourceTagsIn(tpcli.GeneralOutputPanel).
+				StylingOutputLevelUsing(tpcli.WarnLevel, tcell.StyleDefault.Foreground(tcell.ColorOrange).Underline(true)).
+				Start()
+		})
+
+		It("should discard output below the panel's minimum level, and show the rest literally", func() {
+			ui.AddLeveledStringToGeneralOutput(tpcli.DebugLevel, "debugging")
+			ui.AddLeveledStringFromSourceToGeneralOutput(tpcli.WarnLevel, "peer", "careful [red]\nvery careful")
+			ui.AddStringToGeneralOutput("no level")
+			ui.AddLeveledStringToErrorOutput(tpcli.DebugLevel, "debugging")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:4]).To(Equal([]string{
+				"[peer] careful [red]",
+				"[peer] very careful",
+				"no level",
+				"",
+			}))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0]).To(Equal("debugging"))
+		})
+
+		It("should not allow the command panel to have a minimum level", func() {
+			Expect(func() { ui.ShowingOutputAtOrAboveLevel(tpcli.CommandPanel, tpcli.WarnLevel) }).To(Panic())
+		})
+	})
+
+	Context("naming output levels", func() {
+		It("should find levels by name", func() {
+			level, err := tpcli.OutputLevelNamed("Warning")
+			Expect(err).To(BeNil())
+			Expect(level).To(Equal(tpcli.WarnLevel))
+			Expect(tpcli.SuccessLevel.AsString()).To(Equal("success"))
+
+			_, err = tpcli.OutputLevelNamed("loud")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Context("with a theme", func() {
+		JustBeforeEach(func() {
+			ui.UsingTheme(tpcli.LightTheme()).Start()
+		})
+
+		It("should draw the panels in the theme's colors, and highlight the output panel with focus", func() {
+			ui.AddLeveledStringToGeneralOutput(tpcli.ErrorLevel, "failed")
+
+			foreground, background, attributes := ui.RenderedStyleOfScreenAt(1, 1).Decompose()
+			Expect(foreground).To(Equal(tcell.ColorMaroon))
+			Expect(background).To(Equal(tcell.ColorWhite))
+			Expect(attributes & tcell.AttrBold).ToNot(BeZero())
+
+			foreground, _, _ = ui.RenderedStyleOfScreenAt(0, 0).Decompose()
+			Expect(foreground).To(Equal(tcell.ColorGray))
+
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			foreground, _, _ = ui.RenderedStyleOfScreenAt(0, 0).Decompose()
+			Expect(foreground).To(Equal(tcell.ColorNavy))
+		})
+	})
+
+	Context("naming themes", func() {
+		It("should return built-in themes by name", func() {
+			theme, err := tpcli.ThemeNamed("high-contrast")
+			Expect(err).To(BeNil())
+			Expect(theme.FocusedBorder).To(Equal(tcell.ColorYellow))
+
+			_, err = tpcli.ThemeNamed("solarized")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Context("translating ANSI escape sequences", func() {
+		JustBeforeEach(func() {
+			ui.TranslatingANSIIn(tpcli.GeneralOutputPanel).Start()
+		})
+
+		It("should show colored text without the escape sequences, and tview color tags literally", func() {
+			ui.AddStringToGeneralOutput("\x1b[1;31mfailed\x1b[0m: [red]not red[-]")
+			ui.AddStringToGeneralOutput("moved\x1b[2J\x1b[10;1H\x1b]0;title\x07 cursor\r")
+			ui.AddStringToErrorOutput("\x1b[31mplain")
+
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:2]).To(Equal([]string{
+				"failed: [red]not red[-]",
+				"moved cursor",
+			}))
+			Expect(ui.RenderedTextOfErrorOrHistoryPanel()[0]).To(Equal("[31mplain"))
+		})
+
+		It("should find matches in the text as it is shown", func() {
+			ui.AddStringToGeneralOutput("\x1b[32mok\x1b[0m [ok]")
+			ui.AddStringToGeneralOutput("\x1b[31merror\x1b[0m")
+			ui.RenderedTextOfGeneralOutputPanel()
+
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateTypingOf("/ok")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfScreen()[0]).To(ContainSubstring("find 'ok': 2 of 2"))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:2]).To(Equal([]string{"ok [ok]", "error"}))
+
+			ui.SimulateKeyPress(tcell.KeyEscape, 0, tcell.ModNone)
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:2]).To(Equal([]string{"ok [ok]", "error"}))
+		})
+
+		It("should not allow the command panel to translate", func() {
+			Expect(func() { ui.TranslatingANSIIn(tpcli.CommandPanel) }).To(Panic())
+		})
+	})
+
+	Context("finding in an output panel", func() {
+		var titleOfGeneralOutputPanel func() string
+
+		JustBeforeEach(func() {
+			ui.Start()
+			ui.AddStringToGeneralOutput("an error [here]")
+			ui.AddStringToGeneralOutput("all fine")
+			ui.AddStringToGeneralOutput("another error")
+			ui.RenderedTextOfGeneralOutputPanel() // find mode searches only the text already in the panel
+
+			titleOfGeneralOutputPanel = func() string {
+				return ui.RenderedTextOfScreen()[0]
+			}
+
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateTypingOf("/")
+		})
+
+		It("should count literal matches in the title and move between them with n and N", func() {
+			ui.SimulateTypingOf("error")
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find: error_"))
+
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'error': 2 of 2"))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:3]).To(Equal([]string{"an error [here]", "all fine", "another error"}))
+
+			ui.SimulateTypingOf("n")
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'error': 1 of 2"))
+			ui.SimulateTypingOf("N")
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'error': 2 of 2"))
+		})
+
+		It("should find matches of a regular expression", func() {
+			ui.SimulateKeyPress(tcell.KeyCtrlR, 0, tcell.ModCtrl)
+			ui.SimulateTypingOf("^a[a-z]+ ")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find regexp '^a[a-z]+ ': 3 of 3"))
+
+			ui.SimulateTypingOf("/(")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("invalid pattern"))
+		})
+
+		It("should restore the panel, including text added while finding, when <esc> ends find mode", func() {
+			ui.SimulateTypingOf("fine")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.AddStringToGeneralOutput("added [while] finding")
+
+			ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+			Expect(exitFunctionWasFired).To(BeFalse())
+			Expect(titleOfGeneralOutputPanel()).ToNot(ContainSubstring("find"))
+			Expect(ui.RenderedTextOfGeneralOutputPanel()[0:4]).To(Equal([]string{"an error [here]", "all fine", "another error", "added [while] finding"}))
+		})
+
+		Context("with a line limit", func() {
+			BeforeEach(func() {
+				ui.LimitingPanelLinesTo(tpcli.GeneralOutputPanel, 5)
+			})
+
+			It("should find matches only in the lines the panel keeps", func() {
+				ui.SimulateTypingOf("during")
+				for i := 1; i <= 20; i++ {
+					ui.FmtToGeneralOutput("line %d during find", i)
+				}
+				ui.RenderedTextOfGeneralOutputPanel()
+
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+				Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'during': 5 of 5"))
+
+				ui.AddStringToGeneralOutput("one more")
+				ui.AddStringToGeneralOutput("two more")
+				Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'during': 3 of 3"))
+
+				ui.SimulateTypingOf("n")
+				Expect(titleOfGeneralOutputPanel()).To(ContainSubstring("find 'during': 1 of 3"))
+
+				ui.SimulateKeyPress(tcell.KeyESC, 0, tcell.ModNone)
+				Expect(ui.RenderedTextOfGeneralOutputPanel()[0:5]).To(Equal([]string{
+					"line 18 during find", "line 19 during find", "line 20 during find", "one more", "two more",
+				}))
+			})
+		})
+	})
+
+	Context("with the channel of events", func() {
+		var events <-chan *tpcli.Event
+
+		JustBeforeEach(func() {
+			events = ui.ChannelOfEvents()
+			ui.Start()
+		})
+
+		It("should emit events in order", func() {
+			ui.SimulateTypingOf("show")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			ui.SimulateKeyPress(tcell.KeyTab, 0, tcell.ModNone)
+			ui.SimulateResizeTo(100, 40)
+			ui.SimulateKeyPress(tcell.KeyCtrlQ, 0, tcell.ModNone)
+
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.CommandEntered, Command: "show"})))
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.FocusChanged, PanelWithFocus: tpcli.GeneralOutputPanel})))
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.ScreenResized, Columns: 100, Rows: 40})))
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.ExitRequested})))
+			Expect(exitFunctionWasFired).To(BeTrue())
+		})
+
+		It("should deliver entered commands on the command channel only once it is requested", func() {
+			for _, command := range []string{"first", "second"} {
+				ui.SimulateTypingOf(command)
+				ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+				Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.CommandEntered, Command: command})))
+			}
+
+			commands := ui.ChannelOfEnteredCommands()
+			ui.SimulateTypingOf("third")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+			Eventually(commands, time.Second).Should(Receive(Equal("third")))
+		})
+
+		It("should move focus to the previous panel on <shift>-<tab>", func() {
+			ui.SimulateKeyPress(tcell.KeyBacktab, 0, tcell.ModNone)
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.FocusChanged, PanelWithFocus: tpcli.ErrorOrHistoryPanel})))
+		})
+
+		It("should discard the command text and emit an event on ^c", func() {
+			ui.SimulateTypingOf("partial")
+			ui.SimulateKeyPress(tcell.KeyCtrlC, 0, tcell.ModCtrl)
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command>"))
+			Eventually(events, time.Second).Should(Receive(Equal(&tpcli.Event{Type: tpcli.InterruptKeyPressed, Key: tcell.KeyCtrlC})))
+
+			ui.SimulateTypingOf("still running")
+			Expect(ui.RenderedTextOfCommandPanel()[0]).To(Equal("Enter command> still running"))
+		})
+	})
+
+	Context("run with a context", func() {
+		var (
+			cancel             context.CancelFunc
+			errorReturnedByRun chan error
+		)
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			errorReturnedByRun = make(chan error, 1)
+
+			// The prompt provider is first invoked as the UI starts.  The default exit function (unlike the one provided
+			// to OnUIExit in the outer BeforeEach) would exit the test process.
+			uiHasStarted := make(chan struct{})
+			runningUI := tpcli.NewUI().
+				UsingSimulationScreenOfSize(80, 30).
+				UsingPromptProvider(func() string {
+					select {
+					case <-uiHasStarted:
+					default:
+						close(uiHasStarted)
+					}
+					return "Enter command>"
+				})
+			ui = runningUI
+			go func() { errorReturnedByRun <- runningUI.Run(ctx) }()
+			Eventually(uiHasStarted, time.Second).Should(BeClosed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should return when the context is cancelled, and close the command channel after the last command", func() {
+			ui.SimulateTypingOf("last")
+			ui.SimulateKeyPress(tcell.KeyEnter, 0, tcell.ModNone)
+
+			cancel()
+			Eventually(errorReturnedByRun, time.Second).Should(Receive(BeNil()))
+
+			commands := ui.ChannelOfEnteredCommands()
+			Expect(commands).To(Receive(Equal("last")))
+			Eventually(commands, time.Second).Should(BeClosed())
+		})
+
+		It("should return, rather than exit the process, when the user exits", func() {
+			ui.SimulateKeyPress(tcell.KeyCtrlQ, 0, tcell.ModNone)
+			Eventually(errorReturnedByRun, time.Second).Should(Receive(BeNil()))
+		})
+	})
+
+	Context("validating key bindings", func() {
+		It("should accept known keys and actions", func() {
+			for _, keySpec := range []string{"q", "Space", "ctrl-h", "Alt-x", "F12", "Shift-Tab", "Ctrl-X Ctrl-S", "pgdn"} {
+				Expect(tpcli.ValidateKeyBinding(keySpec, "scroll-to-bottom")).To(Succeed(), keySpec)
+			}
+		})
+
+		It("should reject unknown keys and actions", func() {
+			Expect(tpcli.ValidateKeyBinding("Hyper-Q", "exit")).ShouldNot(Succeed())
+			Expect(tpcli.ValidateKeyBinding("", "exit")).ShouldNot(Succeed())
+			Expect(tpcli.ValidateKeyBinding("F1", "launch-rockets")).ShouldNot(Succeed())
+			Expect(func() { ui.BindingKeyTo("Ctrl-Nope", func() {}) }).To(Panic())
+		})
+	})
+})
@@ -0,0 +1,296 @@
+package tpcli
+
+import (
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// viEditingState is the state of the command input panel when vi editing mode is used.  In the insert state, keys
+// are handled as they are in emacs mode, except that <esc> changes to the normal state.  In the normal state, keys
+// are vi motions and commands.
+type viEditingState struct {
+	inNormalState   bool
+	pendingOperator rune // 'd', 'c' or 'y' after the operator is typed, until its motion is typed; otherwise 0
+	register        string
+	undoSnapshots   []lineEditorSnapshot
+}
+
+type lineEditorSnapshot struct {
+	text   []rune
+	cursor int
+}
+
+const (
+	viInsertStateIndicator = "(ins) "
+	viNormalStateIndicator = "(cmd) "
+)
+
+// UsingViEditingMode changes the command input panel to use vi editing, rather than shell-emacs editing.  The panel
+// starts each command in the insert state, and <esc> changes to the normal state, as with "set -o vi" in bash.  The
+// prompt is preceded by "(ins)" or "(cmd)" to show the current state.  In the normal state, the supported motions are
+// h, l, w, b, 0 and $; the operators d, c and y may be followed by a motion (or doubled to act on the whole line);
+// and i, a, I, A, x, D, C, p, P, u (undo), j and k (history navigation) and / (history search) are also supported.
+// When vi editing mode is used, <esc> does not exit while the command input panel has focus.
+func (ui *Tpcli) UsingViEditingMode() *Tpcli {
+	ui.useViEditingMode = true
+	return ui
+}
+
+func (panel *commandInputPanel) UsesViEditing() bool {
+	return panel.viEditing != nil
+}
+
+func (panel *commandInputPanel) useViEditing() {
+	panel.viEditing = &viEditingState{}
+	panel.inputField.SetLabel(panel.labelForCurrentEditingState())
+}
+
+// labelForCurrentEditingState returns the prompt, preceded by an indicator of the vi editing state if vi editing
+// mode is used.
+func (panel *commandInputPanel) labelForCurrentEditingState() string {
+	switch {
+	case panel.viEditing == nil:
+		return panel.promptTextWithTrailingSpace
+	case panel.viEditing.inNormalState:
+		return viNormalStateIndicator + panel.promptTextWithTrailingSpace
+	default:
+		return viInsertStateIndicator + panel.promptTextWithTrailingSpace
+	}
+}
+
+func (panel *commandInputPanel) changeToViInsertState() {
+	panel.viEditing.inNormalState = false
+	panel.viEditing.pendingOperator = 0
+	panel.inputField.SetLabel(panel.labelForCurrentEditingState())
+}
+
+func (panel *commandInputPanel) changeToViNormalState() {
+	panel.viEditing.inNormalState = true
+	panel.inputField.editor.MoveLeft()
+	panel.inputField.SetLabel(panel.labelForCurrentEditingState())
+}
+
+// resetViEditingForNextCommand is invoked after a command is entered.
+func (panel *commandInputPanel) resetViEditingForNextCommand() {
+	panel.viEditing.undoSnapshots = nil
+	panel.changeToViInsertState()
+}
+
+// handleKeyInViEditingMode processes a key event when vi editing mode is used.  In the insert state, only <esc> is
+// handled.  In the normal state, runes are handled as vi commands, and other keys (e.g., <enter>, the arrow keys and
+// control keys) are returned to be processed normally.
+func (panel *commandInputPanel) handleKeyInViEditingMode(event *tcell.EventKey) *tcell.EventKey {
+	vi := panel.viEditing
+
+	if !vi.inNormalState {
+		if event.Key() == tcell.KeyEscape {
+			panel.changeToViNormalState()
+			return nil
+		}
+		return event
+	}
+
+	switch event.Key() {
+	case tcell.KeyRune:
+		if event.Modifiers()&tcell.ModAlt == 0 {
+			textBeforeCommand := panel.inputField.GetText()
+			panel.handleViNormalStateRune(event.Rune())
+			panel.keepViCursorOnText()
+			if textAfterCommand := panel.inputField.GetText(); textAfterCommand != textBeforeCommand {
+				panel.inputField.callbackOnChange(textAfterCommand)
+			}
+			return nil
+		}
+	case tcell.KeyEscape:
+		vi.pendingOperator = 0
+		return nil
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		panel.inputField.editor.MoveLeft()
+		return nil
+	}
+
+	vi.pendingOperator = 0
+	return event
+}
+
+func (panel *commandInputPanel) handleViNormalStateRune(r rune) {
+	vi := panel.viEditing
+	editor := panel.inputField.editor
+
+	if vi.pendingOperator != 0 {
+		operator := vi.pendingOperator
+		vi.pendingOperator = 0
+
+		if r == operator {
+			start, end := editor.boundsOfLineContaining(editor.cursor)
+			panel.applyViOperator(operator, start, end)
+		} else if target, isAMotion := viMotionTarget(editor, r); isAMotion {
+			start, end := editor.cursor, target
+			if start > end {
+				start, end = end, start
+			}
+			if operator == 'c' && r == 'w' {
+				// As in vi, cw changes only to the end of the word, like ce
+				for end > start && unicode.IsSpace(editor.text[end-1]) {
+					end--
+				}
+			}
+			panel.applyViOperator(operator, start, end)
+		}
+		return
+	}
+
+	if target, isAMotion := viMotionTarget(editor, r); isAMotion {
+		editor.cursor = target
+		return
+	}
+
+	switch r {
+	case 'd', 'c', 'y':
+		vi.pendingOperator = r
+	case 'D':
+		_, end := editor.boundsOfLineContaining(editor.cursor)
+		panel.applyViOperator('d', editor.cursor, end)
+	case 'C':
+		_, end := editor.boundsOfLineContaining(editor.cursor)
+		panel.applyViOperator('c', editor.cursor, end)
+	case 'x':
+		if editor.cursor < len(editor.text) {
+			panel.applyViOperator('d', editor.cursor, editor.cursor+1)
+		}
+	case 'i':
+		panel.saveViUndoSnapshot()
+		panel.changeToViInsertState()
+	case 'a':
+		panel.saveViUndoSnapshot()
+		editor.MoveRight()
+		panel.changeToViInsertState()
+	case 'I':
+		panel.saveViUndoSnapshot()
+		editor.MoveToStartOfLine()
+		panel.changeToViInsertState()
+	case 'A':
+		panel.saveViUndoSnapshot()
+		editor.MoveToEndOfLine()
+		panel.changeToViInsertState()
+	case 'p':
+		if vi.register != "" {
+			panel.saveViUndoSnapshot()
+			editor.MoveRight()
+			panel.putViRegister()
+		}
+	case 'P':
+		if vi.register != "" {
+			panel.saveViUndoSnapshot()
+			panel.putViRegister()
+		}
+	case 'u':
+		panel.undoViChange()
+	case 'k':
+		if !editor.MoveUpALine() {
+			panel.navigateHistory(panel.userCommandReadlineHistory.Up, panel.userCommandReadlineHistory.UpWithPrefix)
+			editor.MoveToStart()
+		}
+	case 'j':
+		if !editor.MoveDownALine() {
+			panel.navigateHistory(panel.userCommandReadlineHistory.Down, panel.userCommandReadlineHistory.DownWithPrefix)
+			editor.MoveToStart()
+		}
+	case '/':
+		panel.beginReverseHistorySearch()
+	}
+}
+
+// viMotionTarget returns the position to which a motion would move the cursor.  isAMotion is false if r is not a
+// supported motion.
+func viMotionTarget(editor *lineEditor, r rune) (target int, isAMotion bool) {
+	switch r {
+	case 'h':
+		return maximumOf(editor.cursor-1, 0), true
+	case 'l':
+		return minimumOf(editor.cursor+1, len(editor.text)), true
+	case 'w':
+		target = editor.cursor
+		for target < len(editor.text) && !unicode.IsSpace(editor.text[target]) {
+			target++
+		}
+		for target < len(editor.text) && unicode.IsSpace(editor.text[target]) {
+			target++
+		}
+		return target, true
+	case 'b':
+		return editor.startOfWordBeforeCursor(), true
+	case '0':
+		start, _ := editor.boundsOfLineContaining(editor.cursor)
+		return start, true
+	case '$':
+		_, end := editor.boundsOfLineContaining(editor.cursor)
+		return end, true
+	}
+
+	return 0, false
+}
+
+// applyViOperator applies the operator ('d', 'c' or 'y') to the text from rune index start up to (but excluding)
+// rune index end.  Deleted or yanked text is saved in the register, so that it may be put with p or P.
+func (panel *commandInputPanel) applyViOperator(operator rune, start int, end int) {
+	editor := panel.inputField.editor
+
+	panel.viEditing.register = string(editor.text[start:end])
+
+	if operator == 'y' {
+		editor.cursor = start
+		return
+	}
+
+	panel.saveViUndoSnapshot()
+	editor.ReplaceBetween(start, end, "")
+
+	if operator == 'c' {
+		panel.changeToViInsertState()
+	}
+}
+
+// putViRegister inserts the register at the cursor, leaving the cursor on the last rune inserted.
+func (panel *commandInputPanel) putViRegister() {
+	panel.inputField.editor.Insert(panel.viEditing.register)
+	panel.inputField.editor.MoveLeft()
+}
+
+func (panel *commandInputPanel) saveViUndoSnapshot() {
+	editor := panel.inputField.editor
+	panel.viEditing.undoSnapshots = append(panel.viEditing.undoSnapshots, lineEditorSnapshot{
+		text:   append([]rune{}, editor.text...),
+		cursor: editor.cursor,
+	})
+}
+
+func (panel *commandInputPanel) undoViChange() {
+	vi := panel.viEditing
+	if len(vi.undoSnapshots) == 0 {
+		return
+	}
+
+	snapshot := vi.undoSnapshots[len(vi.undoSnapshots)-1]
+	vi.undoSnapshots = vi.undoSnapshots[:len(vi.undoSnapshots)-1]
+
+	panel.inputField.SetText(string(snapshot.text))
+	panel.inputField.editor.cursor = snapshot.cursor
+}
+
+// keepViCursorOnText moves the cursor onto the last rune if it is after the end of the text, since in the normal
+// state the cursor is always on a rune.
+func (panel *commandInputPanel) keepViCursorOnText() {
+	editor := panel.inputField.editor
+	if panel.viEditing.inNormalState && editor.cursor > 0 && editor.CursorIsAtEnd() {
+		editor.MoveLeft()
+	}
+}
+
+func maximumOf(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}